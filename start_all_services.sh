@@ -10,7 +10,7 @@ sleep 3
 
 # Start Voice Agent on port 8080
 echo "Starting Voice Agent..."
-cd voice-agent && go run main.go &
+cd voice-agent && go run -tags libopus . &
 VOICE_PID=$!
 cd ..
 
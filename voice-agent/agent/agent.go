@@ -0,0 +1,715 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"voice-agent/brain"
+	"voice-agent/llm"
+	"voice-agent/media"
+	"voice-agent/models"
+	"voice-agent/stt"
+	"voice-agent/transcripts"
+	"voice-agent/tts"
+	"voice-agent/vad"
+)
+
+// DefaultSampleRate is the PCM rate requested from TTS for playback unless
+// the voice's output format names another.
+const DefaultSampleRate = 24000
+
+// defaultMaxClarifications is how many times in a row the agent asks the
+// caller to repeat before it escalates.
+const defaultMaxClarifications = 2
+
+// Agent states, reported through OnStateChange.
+const (
+	// StateListening is waiting for the caller to speak.
+	StateListening = "listening"
+	// StateThinking is transcribing the caller and working out a reply.
+	StateThinking = "thinking"
+	// StateSpeaking is playing audio to the caller.
+	StateSpeaking = "speaking"
+)
+
+// Utterance is one stretch of caller speech, encoded in a container the
+// transcription API accepts. Filename carries the extension Whisper uses to
+// detect the format.
+type Utterance struct {
+	Audio    []byte
+	Filename string
+	// Offset is where the audio starts on the call timeline, used to
+	// place transcript timings. It is zero for audio posted by clients.
+	Offset time.Duration
+}
+
+// Speaker plays synthesized agent audio, mono 16-bit little-endian PCM at
+// sampleRate, to the caller. It must stop promptly when ctx is done and
+// report how much audio was played.
+type Speaker interface {
+	Speak(ctx context.Context, pcm io.Reader, sampleRate int) (time.Duration, error)
+}
+
+// DiscardSpeaker consumes audio without playing it. It stands in when the
+// room has no media path back to the caller.
+type DiscardSpeaker struct{}
+
+func (DiscardSpeaker) Speak(ctx context.Context, pcm io.Reader, sampleRate int) (time.Duration, error) {
+	n, err := io.Copy(io.Discard, pcm)
+	log.Printf("Agent audio discarded: %d bytes", n)
+	return time.Duration(n/2) * time.Second / time.Duration(sampleRate), err
+}
+
+// Session is the conversation loop for one room: it waits for the caller to
+// speak, transcribes the utterance, asks the brain for a reply and
+// speaks it back, until the context ends.
+type Session struct {
+	Room  *models.Room
+	Agent *models.Participant
+	User  *models.Participant
+
+	stt        stt.Transcriber
+	tts        tts.Synthesizer
+	brain      brain.Brain
+	speaker    Speaker
+	voice      tts.Options
+	vocabulary *stt.Vocabulary
+
+	// transcripts keeps every transcript message sent, if set.
+	transcripts transcripts.Store
+
+	// language is the configured language or AutoLanguage; spoken is the
+	// one the agent is currently using. voices override voice per
+	// language.
+	language string
+	spoken   string
+	voices   map[string]tts.Options
+
+	// Unclear utterances are answered with a clarification prompt instead
+	// of going to the brain; see clarify.
+	thresholds        stt.Thresholds
+	maxClarifications int
+	clarifications    int
+	nextPrompt        int
+
+	history    []llm.Message
+	utterances chan Utterance
+
+	mu          sync.Mutex
+	cancelReply context.CancelFunc
+
+	state         string
+	onStateChange func(state string)
+}
+
+// NewSession creates the loop for one room. replyBrain decides what the
+// agent says. speaker may be nil, in which case audio is discarded.
+func NewSession(room *models.Room, agent, user *models.Participant, transcriber stt.Transcriber, synthesizer tts.Synthesizer, replyBrain brain.Brain, speaker Speaker) *Session {
+	if speaker == nil {
+		speaker = DiscardSpeaker{}
+	}
+
+	return &Session{
+		Room:       room,
+		Agent:      agent,
+		User:       user,
+		stt:        transcriber,
+		tts:        synthesizer,
+		brain:      replyBrain,
+		speaker:    speaker,
+		language:   "en",
+		spoken:     "en",
+		utterances: make(chan Utterance, 8),
+
+		maxClarifications: defaultMaxClarifications,
+	}
+}
+
+// SetVoice chooses the agent's voice. It must be called before Run.
+func (s *Session) SetVoice(voice tts.Options) {
+	s.voice = voice
+}
+
+// SetTranscriptStore keeps the call's transcript messages in store as they
+// are sent. It must be called before Run.
+func (s *Session) SetTranscriptStore(store transcripts.Store) {
+	s.transcripts = store
+}
+
+// OnStateChange calls f with each state the agent moves into, one of the
+// State constants. It must be called before Run.
+func (s *Session) OnStateChange(f func(state string)) {
+	s.onStateChange = f
+}
+
+func (s *Session) setState(state string) {
+	s.mu.Lock()
+	changed := state != s.state
+	s.state = state
+	s.mu.Unlock()
+
+	if changed && s.onStateChange != nil {
+		s.onStateChange(state)
+	}
+}
+
+// SetLanguage chooses the language the session speaks: a key of Languages,
+// or AutoLanguage to follow the caller, starting in English. voices holds
+// the TTS options to layer over the session voice for each language, such
+// as a multilingual model. It must be called before Run.
+func (s *Session) SetLanguage(language string, voices map[string]tts.Options) {
+	s.language = language
+	s.spoken = language
+	if language == AutoLanguage {
+		s.spoken = "en"
+	}
+	s.voices = voices
+}
+
+// phrases returns the fixed phrases in the language being spoken.
+func (s *Session) phrases() Phrases {
+	return Languages[s.spoken]
+}
+
+// currentVoice is the session voice adjusted for the language being spoken.
+func (s *Session) currentVoice() tts.Options {
+	return s.voice.Merge(s.voices[s.spoken])
+}
+
+// sttLanguage is the language hint for transcription: none in auto mode,
+// so the transcriber detects it.
+func (s *Session) sttLanguage() string {
+	if s.language == AutoLanguage {
+		return ""
+	}
+	return s.language
+}
+
+// SetVocabulary chooses the terms speech recognition is primed with. It
+// must be called before Run.
+func (s *Session) SetVocabulary(vocabulary *stt.Vocabulary) {
+	s.vocabulary = vocabulary
+}
+
+// SetClarification sets when an utterance is too unclear to answer, and
+// how many times in a row the caller is asked to repeat before the agent
+// escalates. It must be called before Run.
+func (s *Session) SetClarification(thresholds stt.Thresholds, maxAttempts int) {
+	s.thresholds = thresholds
+	s.maxClarifications = maxAttempts
+}
+
+// Listen queues a caller utterance for the next turn. It reports false when
+// the queue is full and the utterance was dropped.
+func (s *Session) Listen(u Utterance) bool {
+	select {
+	case s.utterances <- u:
+		return true
+	default:
+		log.Printf("Agent[%s]: utterance queue full, dropping %d bytes", s.Room.ID, len(u.Audio))
+		return false
+	}
+}
+
+// ListenTrack segments PCM frames from the caller's track into utterances
+// with the detector and queues each one for the loop. It returns when frames
+// is closed or ctx is done.
+func (s *Session) ListenTrack(ctx context.Context, frames <-chan []int16, detector *vad.Detector, sampleRate int) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame, ok := <-frames:
+			if !ok {
+				return
+			}
+
+			for _, event := range detector.Process(frame) {
+				switch event.Type {
+				case vad.SpeechStart:
+					s.Interrupt()
+				case vad.SpeechEnd:
+					s.Listen(Utterance{
+						Audio:    media.EncodeWAV(event.Audio, sampleRate),
+						Filename: "audio.wav",
+						Offset:   event.AudioStart,
+					})
+				}
+			}
+		}
+	}
+}
+
+// Interrupt abandons the reply in progress, if any: a pending brain request
+// is cancelled and playback stops. It is called when the caller starts
+// talking over the agent.
+func (s *Session) Interrupt() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancelReply != nil {
+		log.Printf("Agent[%s]: caller barged in", s.Room.ID)
+		s.cancelReply()
+		s.cancelReply = nil
+	}
+}
+
+// beginReply returns a context for one agent reply that Interrupt can cancel,
+// and the function that ends the reply.
+func (s *Session) beginReply(ctx context.Context) (context.Context, func()) {
+	replyCtx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	s.cancelReply = cancel
+	s.mu.Unlock()
+
+	return replyCtx, func() {
+		s.mu.Lock()
+		s.cancelReply = nil
+		s.mu.Unlock()
+		cancel()
+	}
+}
+
+// History returns a copy of the conversation so far.
+func (s *Session) History() []llm.Message {
+	history := make([]llm.Message, len(s.history))
+	copy(history, s.history)
+	return history
+}
+
+// Run greets the caller and then takes turns until ctx is done.
+func (s *Session) Run(ctx context.Context) error {
+	log.Printf("Voice agent running for room %s", s.Room.ID)
+
+	replyCtx, done := s.beginReply(ctx)
+	if err := s.say(replyCtx, s.phrases().Greeting); err != nil {
+		log.Printf("Agent[%s]: greeting failed: %v", s.Room.ID, err)
+	}
+	done()
+	s.setState(StateListening)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case u := <-s.utterances:
+			if err := s.takeTurn(ctx, u); err != nil {
+				log.Printf("Agent[%s]: turn failed: %v", s.Room.ID, err)
+			}
+		}
+	}
+}
+
+func (s *Session) takeTurn(ctx context.Context, u Utterance) error {
+	s.setState(StateThinking)
+	defer s.setState(StateListening)
+
+	transcript, err := stt.TranscribeDetailed(ctx, s.stt, u.Audio, u.Filename, stt.Options{
+		Language: s.sttLanguage(),
+		Prompt:   s.vocabulary.Prompt(),
+	})
+	if err != nil {
+		return fmt.Errorf("transcription failed: %w", err)
+	}
+
+	// Whisper tends to invent a phrase for background noise; segments it
+	// marks as silence are dropped before the brain sees them.
+	transcript = transcript.Speech()
+	text := strings.TrimSpace(transcript.Text)
+	if text == "" {
+		return nil
+	}
+
+	if reason := s.thresholds.Unclear(transcript); reason != "" {
+		log.Printf("Agent[%s]: unclear utterance (%s): %q", s.Room.ID, reason, text)
+		return s.clarify(ctx)
+	}
+	s.clarifications = 0
+
+	if s.language == AutoLanguage {
+		if language := detectLanguage(transcript); language != "" && language != s.spoken {
+			log.Printf("Agent[%s]: caller switched to %s", s.Room.ID, language)
+			s.spoken = language
+		}
+	}
+	if multilingual, ok := s.brain.(brain.Multilingual); ok {
+		multilingual.SetLanguage(s.spoken)
+	}
+
+	log.Printf("Agent[%s] user: %s", s.Room.ID, text)
+	s.history = append(s.history, llm.Message{Role: "user", Content: text})
+	s.sendUserTranscript(transcript, u.Offset)
+
+	replyCtx, done := s.beginReply(ctx)
+	defer done()
+
+	// The brain streams its reply and it is spoken while the rest is still
+	// being generated: a streaming synthesizer takes the text as it comes,
+	// any other is handed one sentence at a time.
+	streaming, isStreaming := s.tts.(tts.StreamingSynthesizer)
+	reply := make(chan string, 32)
+	llmDone := make(chan generation, 1)
+	go func() {
+		defer close(reply)
+		llmDone <- s.generate(replyCtx, s.History(), reply, !isStreaming)
+	}()
+
+	var heard string
+	if isStreaming {
+		heard, err = s.speakStream(replyCtx, streaming, reply)
+	} else {
+		heard, err = s.speakSentences(replyCtx, reply)
+	}
+	interrupted := replyCtx.Err() != nil
+
+	// Stop the stream if playback gave up early, then collect its result.
+	done()
+	result := <-llmDone
+
+	s.history = append(s.history, result.toolMessages...)
+	s.remember(heard)
+
+	if err != nil {
+		return err
+	}
+	if result.err != nil && !interrupted {
+		return fmt.Errorf("reply failed: %w", result.err)
+	}
+	return nil
+}
+
+type generation struct {
+	// toolMessages are the completed tool exchanges, in order, that led up
+	// to the spoken reply.
+	toolMessages []llm.Message
+	err          error
+}
+
+// generate streams the brain's reply to out, as whole sentences when
+// bySentence is set and as raw deltas otherwise.
+func (s *Session) generate(ctx context.Context, history []llm.Message, out chan<- string, bySentence bool) generation {
+	emit := func(text string) {
+		select {
+		case out <- text:
+		case <-ctx.Done():
+		}
+	}
+
+	var splitter sentenceSplitter
+	toolMessages, err := s.brain.Reply(ctx, history, func(delta string) {
+		if !bySentence {
+			emit(delta)
+			return
+		}
+		for _, sentence := range splitter.Push(delta) {
+			emit(sentence)
+		}
+	})
+	if rest := splitter.Flush(); rest != "" {
+		emit(rest)
+	}
+	return generation{toolMessages: toolMessages, err: err}
+}
+
+// say speaks a single, already complete text. It always goes through
+// StreamPCM, even with a streaming synthesizer, so fixed phrases can be
+// served from a cache.
+func (s *Session) say(ctx context.Context, text string) error {
+	sentences := make(chan string, 1)
+	sentences <- text
+	close(sentences)
+
+	heard, err := s.speakSentences(ctx, sentences)
+	s.remember(heard)
+	return err
+}
+
+// clarify asks the caller to repeat, rotating through the prompts, or
+// escalates once they have been asked maxClarifications times in a row.
+func (s *Session) clarify(ctx context.Context) error {
+	replyCtx, done := s.beginReply(ctx)
+	defer done()
+
+	if s.clarifications >= s.maxClarifications {
+		log.Printf("Agent[%s]: escalating after %d clarifications", s.Room.ID, s.clarifications)
+		s.clarifications = 0
+		s.sendEvent(models.EventMessage{Type: "escalation", Reason: "unclear_audio", Timestamp: time.Now()})
+		return s.say(replyCtx, s.phrases().Escalation)
+	}
+
+	prompts := s.phrases().Clarifications
+	prompt := prompts[s.nextPrompt%len(prompts)]
+	s.nextPrompt++
+	s.clarifications++
+	return s.say(replyCtx, prompt)
+}
+
+// remember records what the caller heard of an agent reply.
+func (s *Session) remember(heard string) {
+	if heard == "" {
+		return
+	}
+	log.Printf("Agent[%s] agent: %s", s.Room.ID, heard)
+	s.history = append(s.history, llm.Message{Role: "assistant", Content: heard})
+}
+
+type synthesizedSentence struct {
+	text  string
+	audio io.ReadCloser
+	err   error
+}
+
+// speakSentences synthesizes and plays sentences in order, requesting the
+// next sentence's audio while the current one plays. It returns as much of
+// the text as the caller heard before any interruption, once sentences is
+// closed and drained or ctx is done.
+func (s *Session) speakSentences(ctx context.Context, sentences <-chan string) (string, error) {
+	synthCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	voice := s.currentVoice()
+	sampleRate := tts.PCMSampleRate(voice.OutputFormat, DefaultSampleRate)
+
+	synthesized := make(chan synthesizedSentence, 1)
+	go func() {
+		defer close(synthesized)
+		for sentence := range sentences {
+			audio, err := s.tts.StreamPCM(synthCtx, sentence, voice, sampleRate)
+			select {
+			case synthesized <- synthesizedSentence{text: sentence, audio: audio, err: err}:
+			case <-synthCtx.Done():
+				if audio != nil {
+					audio.Close()
+				}
+				return
+			}
+		}
+	}()
+
+	var (
+		heard    []string
+		speakErr error
+	)
+	for next := range synthesized {
+		if next.err != nil {
+			if ctx.Err() == nil {
+				speakErr = fmt.Errorf("TTS failed: %w", next.err)
+			}
+			break
+		}
+
+		s.sendTranscript("agent", next.text)
+		s.setState(StateSpeaking)
+		played, err := s.speaker.Speak(ctx, next.audio, sampleRate)
+		next.audio.Close()
+
+		if ctx.Err() != nil {
+			if part := heardPortion(next.text, played, s.speakingRate()); part != "" {
+				heard = append(heard, part)
+			}
+			log.Printf("Agent[%s]: interrupted after %v of %q", s.Room.ID, played, next.text)
+			break
+		}
+
+		heard = append(heard, next.text)
+		if err != nil {
+			speakErr = err
+			break
+		}
+	}
+
+	stop()
+	for next := range synthesized {
+		if next.audio != nil {
+			next.audio.Close()
+		}
+	}
+
+	return strings.Join(heard, " "), speakErr
+}
+
+// speakStream feeds reply text to a single synthesis stream as it arrives
+// and plays the audio as it comes back. Transcripts still go out a sentence
+// at a time, and the stream's alignment tells how much of an interrupted
+// reply the caller heard.
+func (s *Session) speakStream(ctx context.Context, synth tts.StreamingSynthesizer, text <-chan string) (string, error) {
+	voice := s.currentVoice()
+	sampleRate := tts.PCMSampleRate(voice.OutputFormat, DefaultSampleRate)
+
+	stream, err := synth.OpenStream(ctx, voice, sampleRate)
+	if err != nil {
+		// Drain the reply so the brain is not left blocked.
+		for range text {
+		}
+		if ctx.Err() != nil {
+			return "", nil
+		}
+		return "", fmt.Errorf("TTS failed: %w", err)
+	}
+	defer stream.Close()
+
+	var full strings.Builder
+	written := make(chan error, 1)
+	go func() {
+		var (
+			splitter sentenceSplitter
+			writeErr error
+		)
+		for delta := range text {
+			full.WriteString(delta)
+			if writeErr != nil {
+				continue
+			}
+
+			writeErr = stream.WriteText(delta)
+			for _, sentence := range splitter.Push(delta) {
+				s.sendTranscript("agent", sentence)
+				if writeErr == nil {
+					writeErr = stream.Flush()
+				}
+			}
+		}
+		if rest := splitter.Flush(); rest != "" {
+			s.sendTranscript("agent", rest)
+		}
+		if writeErr == nil {
+			writeErr = stream.CloseText()
+		}
+		written <- writeErr
+	}()
+
+	s.setState(StateSpeaking)
+	played, err := s.speaker.Speak(ctx, stream, sampleRate)
+	interrupted := ctx.Err() != nil
+	stream.Close()
+	writeErr := <-written
+
+	reply := strings.TrimSpace(full.String())
+	if interrupted {
+		// Without an alignment from the synthesizer, fall back to an
+		// estimate.
+		heard := alignedPortion(stream.Alignment(), played)
+		if len(stream.Alignment().Chars) == 0 {
+			heard = heardPortion(reply, played, s.speakingRate())
+		}
+		log.Printf("Agent[%s]: interrupted after %v of %q", s.Room.ID, played, reply)
+		return heard, nil
+	}
+	if err != nil {
+		return reply, fmt.Errorf("TTS failed: %w", err)
+	}
+	if writeErr != nil {
+		return reply, fmt.Errorf("TTS failed: %w", writeErr)
+	}
+	return reply, nil
+}
+
+// alignedPortion returns the text whose audio had started by played, cut
+// back to a word boundary.
+func alignedPortion(alignment tts.Alignment, played time.Duration) string {
+	spoken := alignment.SpokenBy(played)
+	if spoken == alignment.Text() {
+		return strings.TrimSpace(spoken)
+	}
+
+	cut := strings.LastIndex(spoken, " ")
+	if cut <= 0 {
+		return ""
+	}
+	return strings.TrimSpace(spoken[:cut]) + "..."
+}
+
+// heardPortion estimates how much of text was spoken in played at rate
+// characters per second, cut back to a word boundary.
+func heardPortion(text string, played time.Duration, rate float64) string {
+	runes := []rune(text)
+	n := int(played.Seconds() * rate)
+	if n >= len(runes) {
+		return text
+	}
+
+	spoken := string(runes[:n])
+	cut := strings.LastIndex(spoken, " ")
+	if cut <= 0 {
+		return ""
+	}
+	return spoken[:cut] + "..."
+}
+
+// speakingRate is how many characters per second the current voice speaks
+// in the language being spoken.
+func (s *Session) speakingRate() float64 {
+	rate, ok := speakingRates[s.spoken]
+	if !ok {
+		rate = speakingRates["en"]
+	}
+	if speed := s.currentVoice().Speed; speed > 0 {
+		rate *= speed
+	}
+	return rate
+}
+
+func (s *Session) sendTranscript(speaker, text string) {
+	s.sendTranscriptMessage(models.TranscriptMessage{Speaker: speaker, Text: text})
+}
+
+// sendUserTranscript publishes what the caller said, with its timing on the
+// call timeline and its confidence when the transcriber reported them.
+func (s *Session) sendUserTranscript(transcript *stt.Transcript, offset time.Duration) {
+	msg := models.TranscriptMessage{Speaker: "user", Text: strings.TrimSpace(transcript.Text)}
+
+	if start, end, ok := transcript.Span(); ok {
+		startSeconds := (offset + start).Seconds()
+		endSeconds := (offset + end).Seconds()
+		msg.Start = &startSeconds
+		msg.End = &endSeconds
+	}
+	if confidence, ok := transcript.Confidence(); ok {
+		msg.Confidence = &confidence
+	}
+	s.sendTranscriptMessage(msg)
+}
+
+func (s *Session) sendTranscriptMessage(msg models.TranscriptMessage) {
+	msg.Type = "transcript"
+	msg.Timestamp = time.Now()
+	s.sendEvent(msg)
+	s.storeTranscript(msg)
+}
+
+// storeTranscript adds msg to the call's stored transcript. It does not
+// use the call's context, so the last words of a call that is hanging up
+// are kept too.
+func (s *Session) storeTranscript(msg models.TranscriptMessage) {
+	if s.transcripts == nil {
+		return
+	}
+
+	entry := models.TranscriptEntry{RoomID: s.Room.ID, SessionID: s.User.ID, TranscriptMessage: msg}
+	if err := s.transcripts.Append(context.Background(), entry); err != nil {
+		log.Printf("Agent[%s]: storing transcript failed: %v", s.Room.ID, err)
+	}
+}
+
+// sendEvent sends msg to the caller's data channel as JSON, if it is open.
+func (s *Session) sendEvent(msg interface{}) {
+	dc := s.User.GetDataChannel()
+	if dc == nil {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	if err := dc.SendText(string(data)); err != nil {
+		log.Printf("Agent[%s]: data channel send failed: %v", s.Room.ID, err)
+	}
+}
@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"testing"
+	"time"
+	"voice-agent/tts"
+)
+
+func TestHeardPortion(t *testing.T) {
+	const hindi = "आपकी पॉलिसी सक्रिय है और प्रीमियम भरा हुआ है।"
+
+	for _, tc := range []struct {
+		name   string
+		text   string
+		played time.Duration
+		rate   float64
+		want   string
+	}{
+		{"all of it", "Your policy is active.", 2 * time.Second, 15, "Your policy is active."},
+		{"cut at a word", "Your policy is active.", time.Second, 15, "Your policy is..."},
+		{"less than a word", "Your policy is active.", 200 * time.Millisecond, 15, ""},
+		// Counted in runes, a second at 12 characters per second covers
+		// two words; counted in bytes it would not get past the first.
+		{"Devanagari", hindi, time.Second, speakingRates["hi"], "आपकी पॉलिसी..."},
+		{"Devanagari all of it", hindi, 5 * time.Second, speakingRates["hi"], hindi},
+	} {
+		if got := heardPortion(tc.text, tc.played, tc.rate); got != tc.want {
+			t.Errorf("%s: heardPortion = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestAlignedPortion(t *testing.T) {
+	var alignment tts.Alignment
+	for _, r := range "नमस्ते, आप कैसे हैं?" {
+		alignment.Starts = append(alignment.Starts, time.Duration(len(alignment.Chars))*10*time.Millisecond)
+		alignment.Chars = append(alignment.Chars, string(r))
+	}
+
+	for _, tc := range []struct {
+		played time.Duration
+		want   string
+	}{
+		{time.Second, "नमस्ते, आप कैसे हैं?"},
+		{110 * time.Millisecond, "नमस्ते, आप..."},
+		{30 * time.Millisecond, ""},
+	} {
+		if got := alignedPortion(alignment, tc.played); got != tc.want {
+			t.Errorf("alignedPortion after %v = %q, want %q", tc.played, got, tc.want)
+		}
+	}
+}
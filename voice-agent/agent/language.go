@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"strings"
+	"unicode"
+	"voice-agent/stt"
+)
+
+// AutoLanguage makes a session follow whichever supported language the
+// caller speaks, switching whenever they do.
+const AutoLanguage = "auto"
+
+// Phrases are the fixed things the agent says in one language. They are
+// the same for every caller so their audio can be cached.
+type Phrases struct {
+	// Greeting opens every call.
+	Greeting string
+	// Clarifications ask the caller to repeat an utterance that was not
+	// understood. They are used in turn so the agent does not sound stuck.
+	Clarifications []string
+	// Escalation is said instead of another clarification once the caller
+	// has been asked to repeat too many times in a row.
+	Escalation string
+}
+
+// Languages holds the phrases for each supported language, by ISO-639-1
+// code. Hindi phrases keep insurance terms in English, the way Hinglish
+// speakers use them.
+var Languages = map[string]Phrases{
+	"en": {
+		Greeting: "Hi! I'm your insurance assistant. How can I help with your policy today?",
+		Clarifications: []string{
+			"Sorry, I didn't catch that. Could you say it again?",
+			"I'm sorry, the line broke up. Could you repeat that?",
+			"Apologies, I missed that. Could you say it once more, a little slower?",
+		},
+		Escalation: "I'm having trouble hearing you clearly, so I've flagged this call for our team to follow up with you.",
+	},
+	"hi": {
+		Greeting: "नमस्ते! मैं आपका इंश्योरेंस असिस्टेंट हूँ। आज मैं आपकी पॉलिसी के बारे में कैसे मदद कर सकता हूँ?",
+		Clarifications: []string{
+			"माफ़ कीजिए, मैं ठीक से सुन नहीं पाया। क्या आप दोबारा बोल सकते हैं?",
+			"सॉरी, आवाज़ कट गई। क्या आप फिर से बता सकते हैं?",
+			"माफ़ कीजिए, मुझसे छूट गया। क्या आप थोड़ा धीरे दोबारा बोलेंगे?",
+		},
+		Escalation: "मुझे आपकी आवाज़ साफ़ सुनाई नहीं दे रही है, इसलिए मैंने यह कॉल हमारी टीम को फ़ॉलो-अप के लिए भेज दी है।",
+	},
+}
+
+// speakingRates approximate how many characters of text, counted in runes,
+// TTS speaks per second at normal speed in each language. They are used to
+// work out how much of an interrupted reply the caller heard when the
+// synthesizer does not align its audio with the text.
+var speakingRates = map[string]float64{
+	"en": 15,
+	"hi": 12,
+}
+
+// SupportedLanguage reports whether a session can be set to language.
+func SupportedLanguage(language string) bool {
+	_, ok := Languages[language]
+	return ok || language == AutoLanguage
+}
+
+// languageNames maps the language names Whisper reports in verbose_json to
+// codes. Whisper often labels spoken Hindi as Urdu, which sounds the same,
+// so Urdu is treated as Hindi.
+var languageNames = map[string]string{
+	"english": "en",
+	"hindi":   "hi",
+	"urdu":    "hi",
+	"ur":      "hi",
+}
+
+// detectLanguage returns the supported language t is in, or "" if it cannot
+// tell. It uses the language the transcriber reported and otherwise the
+// script: text mostly in Devanagari is Hindi. Romanized Hinglish cannot be
+// told from English this way and leaves the language as it was.
+func detectLanguage(t *stt.Transcript) string {
+	language := strings.ToLower(t.Language)
+	if code, ok := languageNames[language]; ok {
+		language = code
+	}
+	if _, ok := Languages[language]; ok {
+		return language
+	}
+
+	var letters, devanagari int
+	for _, r := range t.Text {
+		if unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) {
+			letters++
+			if unicode.Is(unicode.Devanagari, r) {
+				devanagari++
+			}
+		}
+	}
+	if letters > 0 && devanagari*2 > letters {
+		return "hi"
+	}
+	return ""
+}
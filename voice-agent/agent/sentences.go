@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations end in a period without ending the sentence. Amounts in
+// policy answers ("Rs. 5,00,000") make this matter.
+var abbreviations = map[string]bool{
+	"rs": true, "mr": true, "mrs": true, "ms": true, "dr": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true,
+}
+
+// numberAbbreviations are only abbreviations before a number ("No. 5");
+// otherwise they end a sentence, as in "No. Your policy lapsed."
+var numberAbbreviations = map[string]bool{
+	"no": true,
+}
+
+// sentenceSplitter cuts a stream of text deltas into complete sentences so
+// each one can go to TTS as soon as it is finished.
+type sentenceSplitter struct {
+	pending string
+}
+
+// Push adds a delta and returns any sentences it completed.
+func (sp *sentenceSplitter) Push(delta string) []string {
+	sp.pending += delta
+
+	var sentences []string
+	for {
+		end := sentenceEnd(sp.pending)
+		if end < 0 {
+			return sentences
+		}
+
+		if sentence := strings.TrimSpace(sp.pending[:end]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		sp.pending = sp.pending[end:]
+	}
+}
+
+// Flush returns whatever text is left after the last sentence boundary.
+func (sp *sentenceSplitter) Flush() string {
+	rest := strings.TrimSpace(sp.pending)
+	sp.pending = ""
+	return rest
+}
+
+// sentenceEnd returns the index just past the first sentence terminator that
+// is followed by whitespace, or -1 if there is none yet. Hindi sentences end
+// with a danda.
+func sentenceEnd(text string) int {
+	for i, r := range text {
+		if r != '.' && r != '!' && r != '?' && r != '।' {
+			continue
+		}
+
+		next := i + utf8.RuneLen(r)
+		if next >= len(text) || !unicode.IsSpace(rune(text[next])) {
+			continue
+		}
+
+		if r == '.' {
+			word := strings.ToLower(text[strings.LastIndexFunc(text[:i], unicode.IsSpace)+1 : i])
+			if abbreviations[word] {
+				continue
+			}
+			if numberAbbreviations[word] {
+				// Whether it ends the sentence depends on what follows,
+				// which may not have arrived yet.
+				after := strings.TrimLeftFunc(text[next:], unicode.IsSpace)
+				if after == "" {
+					return -1
+				}
+				if first, _ := utf8.DecodeRuneInString(after); unicode.IsDigit(first) {
+					continue
+				}
+			}
+		}
+		return next
+	}
+	return -1
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSentenceSplitter(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		deltas []string
+		want   []string
+		rest   string
+	}{
+		{
+			name:   "sentences",
+			deltas: []string{"Your policy is active. Is there ", "anything else? Thanks! Bye"},
+			want:   []string{"Your policy is active.", "Is there anything else?", "Thanks!"},
+			rest:   "Bye",
+		},
+		{
+			// The period is only a boundary once the space after it arrives.
+			name:   "terminator at end of delta",
+			deltas: []string{"Done.", " Next."},
+			want:   []string{"Done."},
+			rest:   "Next.",
+		},
+		{
+			name:   "abbreviations",
+			deltas: []string{"The sum insured is Rs. 5,00,000. Ask Dr. Rao, e.g. about No. 4 etc. later. Sure."},
+			want:   []string{"The sum insured is Rs. 5,00,000.", "Ask Dr. Rao, e.g. about No. 4 etc. later."},
+			rest:   "Sure.",
+		},
+		{
+			// "No." only waits for a number when one follows.
+			name:   "no",
+			deltas: []string{"No. ", "Your policy lapsed. It was No. ", "4 on the list. "},
+			want:   []string{"No.", "Your policy lapsed.", "It was No. 4 on the list."},
+		},
+		{
+			name:   "decimal",
+			deltas: []string{"The premium rose 2.5 percent. "},
+			want:   []string{"The premium rose 2.5 percent."},
+		},
+		{
+			name:   "danda",
+			deltas: []string{"आपकी पॉलिसी सक्रिय है। क्या ", "और कुछ चाहिए? धन्यवाद।"},
+			want:   []string{"आपकी पॉलिसी सक्रिय है।", "क्या और कुछ चाहिए?"},
+			rest:   "धन्यवाद।",
+		},
+		{
+			// The danda is three bytes; a delta may end partway through it.
+			name:   "danda split across deltas",
+			deltas: []string{"सक्रिय है\xe0\xa5", "\xa4 ठीक"},
+			want:   []string{"सक्रिय है।"},
+			rest:   "ठीक",
+		},
+		{
+			name:   "whitespace only",
+			deltas: []string{"  ", "\n"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var sp sentenceSplitter
+			var got []string
+			for _, delta := range tc.deltas {
+				got = append(got, sp.Push(delta)...)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("sentences = %q, want %q", got, tc.want)
+			}
+			if rest := sp.Flush(); rest != tc.rest {
+				t.Errorf("Flush() = %q, want %q", rest, tc.rest)
+			}
+			if rest := sp.Flush(); rest != "" {
+				t.Errorf("second Flush() = %q", rest)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// Package brain decides what the voice agent says. The agent loop hands it
+// the conversation and speaks whatever text it streams back.
+package brain
+
+import (
+	"context"
+	"fmt"
+	"voice-agent/llm"
+)
+
+// SystemPrompt is the voice-optimized prompt based on LiveKit/Vapi best practices.
+const SystemPrompt = `You are a helpful insurance assistant in a voice call.
+
+## Style Guardrails
+- Keep responses under 2 sentences (max 280 characters)
+- Be warm, empathetic, and conversational
+- Use natural speech - be direct and clear
+- If the answer is complex, give the most important point first, then ask if they want more details
+
+## Goal
+Answer insurance policy questions quickly and accurately.
+
+## Tool Usage
+- For policy questions: retrieve policy info first, then answer
+- For claims: provide direct contact info or next steps
+
+## Example Responses
+User: "What's covered in my policy?"
+You: "Your policy covers hospitalization up to your sum insured, plus 60 days pre and post hospitalization. Want details on specific benefits?"
+
+User: "How do I make a claim?"
+You: "Call customer care or file online through the portal. Need the customer care number?"
+`
+
+// Brain produces the agent's reply to the caller's latest turn.
+type Brain interface {
+	// Reply answers the last user message in history, calling onDelta with
+	// reply text as it streams. It returns any messages that belong in the
+	// history ahead of the spoken reply, such as tool exchanges. Cancelling
+	// ctx abandons the reply.
+	Reply(ctx context.Context, history []llm.Message, onDelta func(string)) ([]llm.Message, error)
+}
+
+// Multilingual is implemented by brains that can be told which language to
+// answer in. Brains that are not follow the caller's language on their own.
+type Multilingual interface {
+	// SetLanguage sets the ISO-639-1 language of the next replies.
+	SetLanguage(language string)
+}
+
+// LanguagePrompt returns the system prompt section asking for replies in
+// language, or "" for English, which SystemPrompt already assumes.
+func LanguagePrompt(language string) string {
+	switch language {
+	case "", "en":
+		return ""
+	case "hi":
+		return "\n## Language\nThe caller is speaking Hindi, possibly mixed with English (Hinglish). Reply in the same mix: write Hindi in Devanagari script, and keep product names, amounts and insurance terms such as \"sum insured\", \"Care Shield\" or \"claim\" in English.\n"
+	}
+	return fmt.Sprintf("\n## Language\nReply in the language with ISO-639-1 code %q.\n", language)
+}
+
+// CallerPrompt extends SystemPrompt with what is known about the caller.
+func CallerPrompt(phoneNumber string) string {
+	if phoneNumber == "" {
+		return SystemPrompt
+	}
+	return SystemPrompt + fmt.Sprintf("\n## Caller\nThe caller started this call with mobile number %s. Use it for policy lookups unless they give another.\n", phoneNumber)
+}
@@ -0,0 +1,77 @@
+package brain
+
+import (
+	"context"
+	"log"
+	"sync"
+	"voice-agent/llm"
+	"voice-agent/tools"
+)
+
+// maxToolRounds bounds how many times one turn may go back to the model with
+// tool results before it must answer.
+const maxToolRounds = 3
+
+// Chat answers with a chat model, running any tools the model calls from the
+// registry.
+type Chat struct {
+	model        llm.ChatModel
+	tools        *tools.Registry
+	systemPrompt string
+
+	mu       sync.Mutex
+	language string
+}
+
+// NewChat creates a brain backed by model. toolRegistry may be nil.
+func NewChat(model llm.ChatModel, toolRegistry *tools.Registry, systemPrompt string) *Chat {
+	return &Chat{
+		model:        model,
+		tools:        toolRegistry,
+		systemPrompt: systemPrompt,
+	}
+}
+
+// SetLanguage makes the following replies use language, by extending the
+// system prompt.
+func (c *Chat) SetLanguage(language string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.language = language
+}
+
+func (c *Chat) Reply(ctx context.Context, history []llm.Message, onDelta func(string)) ([]llm.Message, error) {
+	c.mu.Lock()
+	systemPrompt := c.systemPrompt + LanguagePrompt(c.language)
+	c.mu.Unlock()
+
+	var definitions []llm.Tool
+	if c.tools != nil {
+		definitions = c.tools.Definitions()
+	}
+
+	var toolMessages []llm.Message
+	for round := 0; ; round++ {
+		// The last round withholds the tools so the model has to answer.
+		if round == maxToolRounds {
+			definitions = nil
+		}
+
+		reply, err := c.model.StreamChatCompletion(ctx, history, systemPrompt, definitions, onDelta)
+		if err != nil || len(reply.ToolCalls) == 0 {
+			return toolMessages, err
+		}
+
+		exchange := []llm.Message{reply}
+		for _, call := range reply.ToolCalls {
+			log.Printf("Calling tool %s(%s)", call.Function.Name, call.Function.Arguments)
+			exchange = append(exchange, c.tools.Call(ctx, call))
+		}
+		if err := ctx.Err(); err != nil {
+			return toolMessages, err
+		}
+
+		history = append(history, exchange...)
+		toolMessages = append(toolMessages, exchange...)
+	}
+}
@@ -0,0 +1,203 @@
+package brain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+	"voice-agent/llm"
+)
+
+// VoiceStream delegates each turn to the Python API's voice-stream endpoint,
+// which owns policy lookup, mobile number extraction and conversation state.
+// Only the caller's latest message is sent; the Python session remembers the
+// rest, including the caller's mobile number once it is set as the
+// session's base identifier.
+type VoiceStream struct {
+	baseURL      string
+	mobileNumber string
+	client       *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+type voiceStreamRequest struct {
+	Prompt    string `json:"prompt"`
+	SessionID string `json:"session_id"`
+}
+
+type baseIdentifierRequest struct {
+	BaseIdentifier string `json:"base_identifier"`
+}
+
+type createSessionResponse struct {
+	SessionID string `json:"session_id"`
+}
+
+// NewVoiceStream creates a brain backed by the Python API at baseURL, for
+// example "http://localhost:8000". mobileNumber, when known, becomes the
+// Python session's base identifier when the session is created.
+func NewVoiceStream(baseURL, mobileNumber string) *VoiceStream {
+	return &VoiceStream{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		mobileNumber: mobileNumber,
+		client:       &http.Client{},
+	}
+}
+
+func (v *VoiceStream) Reply(ctx context.Context, history []llm.Message, onDelta func(string)) ([]llm.Message, error) {
+	prompt := lastUserMessage(history)
+	if prompt == "" {
+		return nil, fmt.Errorf("no user message to answer")
+	}
+
+	sessionID, err := v.session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	payload, err := json.Marshal(voiceStreamRequest{
+		Prompt:    prompt,
+		SessionID: sessionID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := v.do(ctx, http.MethodPost, "/api/v1/insurance/chat/voice-stream", payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return nil, streamText(resp.Body, onDelta)
+}
+
+// session returns the Python session for this call, creating it on first use.
+func (v *VoiceStream) session(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.sessionID != "" {
+		return v.sessionID, nil
+	}
+
+	resp, err := v.do(ctx, http.MethodPost, "/api/v1/sessions", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result createSessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.SessionID == "" {
+		return "", fmt.Errorf("no session_id in response")
+	}
+
+	v.sessionID = result.SessionID
+
+	// The session still works without it; Python then asks the caller.
+	if v.mobileNumber != "" {
+		if err := v.setBaseIdentifier(ctx, v.mobileNumber); err != nil {
+			log.Printf("VoiceStream: mobile number not set on session %s: %v", v.sessionID, err)
+		}
+	}
+	return v.sessionID, nil
+}
+
+func (v *VoiceStream) setBaseIdentifier(ctx context.Context, identifier string) error {
+	payload, err := json.Marshal(baseIdentifierRequest{BaseIdentifier: identifier})
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.do(ctx, http.MethodPut, "/api/v1/sessions/"+v.sessionID+"/base-identifier", payload)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (v *VoiceStream) do(ctx context.Context, method, path string, payload []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, v.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("Python API error (%d): %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+// streamText passes a chunked text body to onDelta as it arrives, holding
+// back any multi-byte character split across reads.
+func streamText(body io.Reader, onDelta func(string)) error {
+	buf := make([]byte, 4096)
+	var pending []byte
+
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			cut := completeRunes(pending)
+			if cut > 0 {
+				onDelta(string(pending[:cut]))
+				pending = append(pending[:0], pending[cut:]...)
+			}
+		}
+
+		if err == io.EOF {
+			if len(pending) > 0 {
+				onDelta(string(pending))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// completeRunes returns the length of the longest prefix of p that does not
+// end partway through a UTF-8 sequence.
+func completeRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(p[i]) {
+			continue
+		}
+		if utf8.FullRune(p[i:]) {
+			return len(p)
+		}
+		return i
+	}
+	return len(p)
+}
+
+func lastUserMessage(history []llm.Message) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			return history[i].Content
+		}
+	}
+	return ""
+}
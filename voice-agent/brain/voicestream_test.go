@@ -0,0 +1,141 @@
+package brain_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"voice-agent/brain"
+	"voice-agent/llm"
+)
+
+// pythonAPI stands in for the FastAPI app's session and voice-stream
+// endpoints.
+type pythonAPI struct {
+	mu             sync.Mutex
+	sessions       int
+	baseIdentifier string
+	requests       []map[string]interface{}
+
+	// firstChunkRead is closed by the test once the first chunk of a reply
+	// has reached it, before the rest of the reply is written.
+	firstChunkRead chan struct{}
+}
+
+func (p *pythonAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/sessions":
+		p.mu.Lock()
+		p.sessions++
+		p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"session_id": "py-session"})
+
+	case r.Method == http.MethodPut && r.URL.Path == "/api/v1/sessions/py-session/base-identifier":
+		var body struct {
+			BaseIdentifier string `json:"base_identifier"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		p.mu.Lock()
+		p.baseIdentifier = body.BaseIdentifier
+		p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"session_id": "py-session"})
+
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/insurance/chat/voice-stream":
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		p.mu.Lock()
+		p.requests = append(p.requests, body)
+		p.mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("Your policy "))
+		w.(http.Flusher).Flush()
+		select {
+		case <-p.firstChunkRead:
+		case <-time.After(5 * time.Second):
+			return // not streamed; the reply ends short
+		}
+
+		// The next flush ends partway through the first character of
+		// "नमस्ते".
+		namaste := []byte("नमस्ते.")
+		w.Write(append([]byte("is active. "), namaste[:1]...))
+		w.(http.Flusher).Flush()
+		w.Write(namaste[1:])
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestVoiceStream(t *testing.T) {
+	api := &pythonAPI{firstChunkRead: make(chan struct{})}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	v := brain.NewVoiceStream(server.URL+"/", "9876543210")
+	history := []llm.Message{
+		{Role: "assistant", Content: "Hi! How can I help?"},
+		{Role: "user", Content: "Is my policy active?"},
+	}
+
+	// The reply only continues once its first chunk has been passed on.
+	var deltas []string
+	var once sync.Once
+	reply, err := v.Reply(context.Background(), history, func(delta string) {
+		deltas = append(deltas, delta)
+		once.Do(func() { close(api.firstChunkRead) })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != nil {
+		t.Errorf("reply messages = %+v, want none", reply)
+	}
+	if got := strings.Join(deltas, ""); got != "Your policy is active. नमस्ते." || deltas[0] != "Your policy " {
+		t.Errorf("streamed %q", deltas)
+	}
+	for _, delta := range deltas {
+		if !utf8.ValidString(delta) {
+			t.Errorf("delta %q splits a character", delta)
+		}
+	}
+
+	// A second turn reuses the session.
+	if _, err := v.Reply(context.Background(), append(history, llm.Message{Role: "user", Content: "Thanks"}), func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.sessions != 1 || api.baseIdentifier != "9876543210" {
+		t.Errorf("%d sessions created, base identifier %q", api.sessions, api.baseIdentifier)
+	}
+	if len(api.requests) != 2 {
+		t.Fatalf("%d voice-stream requests", len(api.requests))
+	}
+	if got := api.requests[0]; len(got) != 2 || got["prompt"] != "Is my policy active?" || got["session_id"] != "py-session" {
+		t.Errorf("voice-stream body = %v", got)
+	}
+	if got := api.requests[1]["prompt"]; got != "Thanks" {
+		t.Errorf("second prompt = %v", got)
+	}
+}
+
+func TestVoiceStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database down", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := brain.NewVoiceStream(server.URL, "").Reply(context.Background(),
+		[]llm.Message{{Role: "user", Content: "Hello?"}}, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "database down") {
+		t.Errorf("error = %v", err)
+	}
+}
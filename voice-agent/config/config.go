@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 )
 
 type Config struct {
@@ -11,6 +12,93 @@ type Config struct {
 	STUNServers     []string
 	TURNServers     []TURNServer
 	SessionTimeout  int
+	PoliciesPath    string
+
+	// STTVocabularyDocs is a directory of policy wordings in Markdown. With
+	// the policies file it supplies the product names and terms the
+	// transcriber is primed with.
+	STTVocabularyDocs string
+
+	// Utterances below STTMinConfidence, or with fewer than STTMinLetters
+	// letters, make the agent ask the caller to repeat, at most
+	// AgentMaxClarifications times in a row before it escalates.
+	STTMinConfidence       float64
+	STTMinLetters          int
+	AgentMaxClarifications int
+
+	// ICEIncludeLoopback offers 127.0.0.1 candidates, for clients on the same
+	// host such as the end-to-end tests.
+	ICEIncludeLoopback bool
+
+	// ICETrickle sends the server's ICE candidates to clients as they are
+	// gathered instead of holding answers until gathering completes.
+	// Clients on the signaling WebSocket trickle whenever it is on; HTTP
+	// clients ask for it per offer.
+	ICETrickle bool
+
+	// Providers are looked up by name in the stt, tts and llm registries.
+	STTProvider string
+	TTSProvider string
+	LLMProvider string
+
+	// Default agent voice. Sessions may override any of these when they
+	// start; see tts.Options.
+	TTSVoiceID         string
+	TTSModelID         string
+	TTSOutputFormat    string
+	TTSSpeed           float64
+	TTSStability       float64
+	TTSSimilarityBoost float64
+
+	// AgentLanguage is the language calls start in: "en", "hi", or "auto" to
+	// follow the caller. Hindi replies use TTSHindiModelID, a multilingual
+	// model, and TTSHindiVoiceID if set.
+	AgentLanguage   string
+	TTSHindiVoiceID string
+	TTSHindiModelID string
+
+	// TTSCacheDir keeps synthesized audio for the agent's fixed phrases; empty
+	// disables the cache. TTSPrewarmFile lists phrases, one per line, that
+	// the prewarm command synthesizes ahead of time.
+	TTSCacheDir    string
+	TTSCacheMaxMB  int
+	TTSPrewarmFile string
+
+	// RecordingDir is where calls are recorded, one directory per room;
+	// empty, the default, disables recording. RecordingMix adds a stereo
+	// mix of the caller and the agent to each recording. Recordings are
+	// never deleted by the service.
+	RecordingDir string
+	RecordingMix bool
+
+	// TranscriptStore names where call transcripts are kept: "jsonl", one
+	// file per room in TranscriptDir, or "sqlite", the database at
+	// TranscriptDB. Empty, the default, disables storage. Stored
+	// transcripts are never deleted by the service.
+	TranscriptStore string
+	TranscriptDir   string
+	TranscriptDB    string
+
+	// CallSummaries has the chat model write up each call from its stored
+	// transcript once it ends. It is off by default and needs a
+	// TranscriptStore.
+	CallSummaries bool
+
+	// ElevenLabsWSURL is the origin of the stream-input WebSocket API used by
+	// the "elevenlabs-ws" TTS provider.
+	ElevenLabsWSURL string
+
+	// AgentBrain picks what answers the caller: "llm" for the configured chat
+	// model, "python" to delegate to the Python API's voice-stream endpoint at
+	// PythonAPIURL.
+	AgentBrain   string
+	PythonAPIURL string
+
+	// Caller speech endpointing; see package vad.
+	VADSpeechThreshold  float64
+	VADSilenceThreshold float64
+	VADMinSpeechMs      int
+	VADHangoverMs       int
 }
 
 type TURNServer struct {
@@ -25,6 +113,54 @@ func Load() *Config {
 		OpenAIKey:      getEnv("OPENAI_API_KEY", "sk-wTEb9UX"),
 		ElevenLabsKey:  "sk_09237dce5554d4628542318e89acb7583136223540e76ae8",
 		SessionTimeout: 3600,
+		PoliciesPath:   getEnv("POLICIES_PATH", "../Insurance/purchase_policies.json"),
+
+		STTVocabularyDocs: getEnv("STT_VOCABULARY_DOCS", "../Insurance/pdf_md"),
+
+		STTMinConfidence:       getEnvFloat("STT_MIN_CONFIDENCE", 0.45),
+		STTMinLetters:          getEnvInt("STT_MIN_LETTERS", 2),
+		AgentMaxClarifications: getEnvInt("AGENT_MAX_CLARIFICATIONS", 2),
+
+		ICEIncludeLoopback: getEnvBool("ICE_INCLUDE_LOOPBACK", false),
+		ICETrickle:         getEnvBool("ICE_TRICKLE", true),
+
+		STTProvider: getEnv("STT_PROVIDER", "openai"),
+		TTSProvider: getEnv("TTS_PROVIDER", "elevenlabs"),
+		LLMProvider: getEnv("LLM_PROVIDER", "openai"),
+
+		TTSVoiceID:         getEnv("TTS_VOICE_ID", "1qEiC6qsybMkmnNdVMbK"),
+		TTSModelID:         getEnv("TTS_MODEL_ID", "eleven_flash_v2_5"),
+		TTSOutputFormat:    getEnv("TTS_OUTPUT_FORMAT", "pcm_24000"),
+		TTSSpeed:           getEnvFloat("TTS_SPEED", 1.0),
+		TTSStability:       getEnvFloat("TTS_STABILITY", 0.5),
+		TTSSimilarityBoost: getEnvFloat("TTS_SIMILARITY_BOOST", 0.75),
+
+		AgentLanguage:   getEnv("AGENT_LANGUAGE", "en"),
+		TTSHindiVoiceID: getEnv("TTS_HINDI_VOICE_ID", ""),
+		TTSHindiModelID: getEnv("TTS_HINDI_MODEL_ID", "eleven_multilingual_v2"),
+
+		TTSCacheDir:    getEnv("TTS_CACHE_DIR", "tts-cache"),
+		TTSCacheMaxMB:  getEnvInt("TTS_CACHE_MAX_MB", 256),
+		TTSPrewarmFile: getEnv("TTS_PREWARM_FILE", "prewarm_phrases.txt"),
+
+		RecordingDir: getEnv("RECORDING_DIR", ""),
+		RecordingMix: getEnvBool("RECORDING_MIX", false),
+
+		TranscriptStore: getEnv("TRANSCRIPT_STORE", ""),
+		TranscriptDir:   getEnv("TRANSCRIPT_DIR", "call-transcripts"),
+		TranscriptDB:    getEnv("TRANSCRIPT_DB", "transcripts.db"),
+		CallSummaries:   getEnvBool("CALL_SUMMARIES", false),
+
+		ElevenLabsWSURL: getEnv("ELEVENLABS_WS_URL", "wss://api.elevenlabs.io"),
+
+		AgentBrain:   getEnv("AGENT_BRAIN", "llm"),
+		PythonAPIURL: getEnv("PYTHON_API_URL", "http://localhost:8000"),
+
+		VADSpeechThreshold:  getEnvFloat("VAD_SPEECH_THRESHOLD_DBFS", -40),
+		VADSilenceThreshold: getEnvFloat("VAD_SILENCE_THRESHOLD_DBFS", -48),
+		VADMinSpeechMs:      getEnvInt("VAD_MIN_SPEECH_MS", 200),
+		VADHangoverMs:       getEnvInt("VAD_HANGOVER_MS", 700),
+
 		STUNServers: []string{
 			"stun:stun.l.google.com:19302",
 			"stun:stun1.l.google.com:19302",
@@ -45,3 +181,24 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvInt(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,60 @@
+package fake
+
+import (
+	"encoding/binary"
+	"fmt"
+	"voice-agent/media"
+)
+
+// codecRate is the rate a fake packet carries its audio at. 20 ms at 8 kHz
+// is 320 bytes, which fits comfortably in one RTP packet.
+const codecRate = 8000
+
+// Codec stands in for Opus in builds without libopus. A "packet" is the frame
+// resampled to 8 kHz as 16-bit little-endian PCM, so audio survives a round
+// trip through RTP and level checks still work on the far side.
+type Codec struct {
+	sampleRate int
+}
+
+// NewEncoder has the signature of media.NewEncoder.
+func NewEncoder(sampleRate, channels int) (media.Encoder, error) {
+	return newCodec(sampleRate, channels)
+}
+
+// NewDecoder has the signature of media.NewDecoder.
+func NewDecoder(sampleRate, channels int) (media.Decoder, error) {
+	return newCodec(sampleRate, channels)
+}
+
+func newCodec(sampleRate, channels int) (*Codec, error) {
+	if channels != 1 {
+		return nil, fmt.Errorf("fake codec supports mono only, got %d channels", channels)
+	}
+	return &Codec{sampleRate: sampleRate}, nil
+}
+
+func (c *Codec) Encode(pcm []int16, packet []byte) (int, error) {
+	samples := media.Resample(pcm, c.sampleRate, codecRate)
+	if len(samples)*2 > len(packet) {
+		return 0, fmt.Errorf("fake codec: packet buffer too small")
+	}
+	for i, v := range samples {
+		binary.LittleEndian.PutUint16(packet[i*2:], uint16(v))
+	}
+	return len(samples) * 2, nil
+}
+
+func (c *Codec) Decode(packet []byte, pcm []int16) (int, error) {
+	samples := make([]int16, len(packet)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(packet[i*2:]))
+	}
+	return copy(pcm, media.Resample(samples, codecRate, c.sampleRate)), nil
+}
+
+func (c *Codec) Conceal(pcm []int16) (int, error) {
+	n := min(media.SamplesPerFrame(c.sampleRate), len(pcm))
+	clear(pcm[:n])
+	return n, nil
+}
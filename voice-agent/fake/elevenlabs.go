@@ -0,0 +1,131 @@
+package fake
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ElevenLabsServer stands in for ElevenLabs' stream-input WebSocket API. Each
+// flush, and the end of input, produces one audio message: a tone lasting
+// PerCharacter per character with alignment for every character.
+type ElevenLabsServer struct {
+	*httptest.Server
+
+	PerCharacter time.Duration
+
+	mu       sync.Mutex
+	messages []map[string]interface{}
+	paths    []string
+}
+
+func NewElevenLabsServer() *ElevenLabsServer {
+	s := &ElevenLabsServer{PerCharacter: 5 * time.Millisecond}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL returns the origin to give tts.NewElevenLabsStream.
+func (s *ElevenLabsServer) URL() string {
+	return "ws" + strings.TrimPrefix(s.Server.URL, "http")
+}
+
+// Messages returns every message clients have sent, in order.
+func (s *ElevenLabsServer) Messages() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.messages...)
+}
+
+// Paths returns the request path and query of each connection.
+func (s *ElevenLabsServer) Paths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.paths...)
+}
+
+var upgrader = websocket.Upgrader{}
+
+func (s *ElevenLabsServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("xi-api-key") == "" {
+		http.Error(w, "missing xi-api-key", http.StatusUnauthorized)
+		return
+	}
+
+	sampleRate := 16000
+	if format, ok := strings.CutPrefix(r.URL.Query().Get("output_format"), "pcm_"); ok {
+		if rate, err := strconv.Atoi(format); err == nil {
+			sampleRate = rate
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.paths = append(s.paths, r.URL.RequestURI())
+	s.mu.Unlock()
+
+	var pending strings.Builder
+	first := true
+	for {
+		var msg map[string]interface{}
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.messages = append(s.messages, msg)
+		s.mu.Unlock()
+
+		text, _ := msg["text"].(string)
+		flush, _ := msg["flush"].(bool)
+		end := text == ""
+		if !first {
+			pending.WriteString(text)
+		}
+		first = false
+
+		if (flush || end) && strings.TrimSpace(pending.String()) != "" {
+			if err := conn.WriteJSON(s.speak(pending.String(), sampleRate)); err != nil {
+				return
+			}
+			pending.Reset()
+		}
+		if end {
+			conn.WriteJSON(map[string]interface{}{"isFinal": true})
+			return
+		}
+	}
+}
+
+func (s *ElevenLabsServer) speak(text string, sampleRate int) map[string]interface{} {
+	chars := strings.Split(text, "")
+	starts := make([]int, len(chars))
+	for i := range chars {
+		starts[i] = int((time.Duration(i) * s.PerCharacter).Milliseconds())
+	}
+
+	pcm := Tone(440, 0.3, time.Duration(len(chars))*s.PerCharacter, sampleRate)
+	audio := make([]byte, len(pcm)*2)
+	for i, v := range pcm {
+		binary.LittleEndian.PutUint16(audio[i*2:], uint16(v))
+	}
+
+	return map[string]interface{}{
+		"audio": base64.StdEncoding.EncodeToString(audio),
+		"alignment": map[string]interface{}{
+			"chars":            chars,
+			"charStartTimesMs": starts,
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"voice-agent/llm"
+)
+
+// ChatModel streams scripted replies word by word, one per call, repeating
+// the last one once the script runs out.
+type ChatModel struct {
+	mu       sync.Mutex
+	script   []string
+	calls    int
+	requests [][]llm.Message
+	prompts  []string
+}
+
+func NewChatModel(script ...string) *ChatModel {
+	return &ChatModel{script: script}
+}
+
+func (c *ChatModel) StreamChatCompletion(ctx context.Context, messages []llm.Message, systemPrompt string, tools []llm.Tool, onDelta func(string)) (llm.Message, error) {
+	c.mu.Lock()
+	c.requests = append(c.requests, append([]llm.Message(nil), messages...))
+	c.prompts = append(c.prompts, systemPrompt)
+	reply := fmt.Sprintf("Reply %d.", c.calls+1)
+	if len(c.script) > 0 {
+		reply = c.script[min(c.calls, len(c.script)-1)]
+	}
+	c.calls++
+	c.mu.Unlock()
+
+	words := strings.SplitAfter(reply, " ")
+	for _, word := range words {
+		if err := ctx.Err(); err != nil {
+			return llm.Message{Role: "assistant"}, err
+		}
+		onDelta(word)
+	}
+	return llm.Message{Role: "assistant", Content: reply}, nil
+}
+
+// Requests returns the conversation sent with each call so far.
+func (c *ChatModel) Requests() [][]llm.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]llm.Message(nil), c.requests...)
+}
+
+// SystemPrompts returns the system prompt sent with each call so far.
+func (c *ChatModel) SystemPrompts() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.prompts...)
+}
@@ -0,0 +1,95 @@
+// Package fake provides in-process stand-ins for the speech, chat and codec
+// providers so the whole call path can run without network access or
+// libopus. Everything is deterministic: transcripts and replies are
+// scripted, and speech is a tone whose length follows the text.
+package fake
+
+import (
+	"context"
+	"sync"
+	"time"
+	"voice-agent/stt"
+)
+
+// Transcriber returns scripted transcripts, one per call, repeating the last
+// one once the script runs out.
+type Transcriber struct {
+	mu        sync.Mutex
+	script    []string
+	languages []string
+	pauses    []time.Duration
+	calls     int
+	audio     [][]byte
+	options   []stt.Options
+}
+
+func NewTranscriber(script ...string) *Transcriber {
+	return &Transcriber{script: script}
+}
+
+// SetLanguages scripts the language reported with each transcript, the way
+// Whisper names it in verbose_json. An empty entry reports the requested
+// language, as a transcriber without detection would.
+func (t *Transcriber) SetLanguages(languages ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.languages = languages
+}
+
+// SetPauses scripts timings for each transcript: a second of speech, if
+// there is text, followed by the given pause before the audio ends. Without
+// pauses, transcripts carry no timings.
+func (t *Transcriber) SetPauses(pauses ...time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pauses = pauses
+}
+
+func (t *Transcriber) Transcribe(ctx context.Context, audioData []byte, filename string, opts stt.Options) (string, error) {
+	transcript, err := t.TranscribeDetailed(ctx, audioData, filename, opts)
+	if err != nil {
+		return "", err
+	}
+	return transcript.Text, nil
+}
+
+func (t *Transcriber) TranscribeDetailed(ctx context.Context, audioData []byte, filename string, opts stt.Options) (*stt.Transcript, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.audio = append(t.audio, audioData)
+	t.options = append(t.options, opts)
+	transcript := &stt.Transcript{Language: opts.Language}
+	if len(t.script) > 0 {
+		transcript.Text = t.script[min(t.calls, len(t.script)-1)]
+	}
+	if len(t.languages) > 0 {
+		if language := t.languages[min(t.calls, len(t.languages)-1)]; language != "" {
+			transcript.Language = language
+		}
+	}
+	if len(t.pauses) > 0 {
+		speech := time.Duration(0)
+		if transcript.Text != "" {
+			speech = time.Second
+			transcript.Segments = []stt.Segment{{Text: transcript.Text, End: speech}}
+		}
+		transcript.Duration = speech + t.pauses[min(t.calls, len(t.pauses)-1)]
+	}
+	t.calls++
+	return transcript, nil
+}
+
+// Audio returns the utterances transcribed so far.
+func (t *Transcriber) Audio() [][]byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([][]byte(nil), t.audio...)
+}
+
+// Options returns the options of each transcription so far.
+func (t *Transcriber) Options() []stt.Options {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]stt.Options(nil), t.options...)
+}
@@ -0,0 +1,83 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"time"
+	"voice-agent/tts"
+)
+
+// Synthesizer speaks every text as a sine tone lasting PerCharacter per
+// character of text.
+type Synthesizer struct {
+	Frequency    float64
+	Amplitude    float64
+	PerCharacter time.Duration
+
+	// Voices, when set, are the only voice IDs ValidateVoice accepts.
+	Voices []string
+
+	mu      sync.Mutex
+	texts   []string
+	options []tts.Options
+}
+
+func NewSynthesizer() *Synthesizer {
+	return &Synthesizer{
+		Frequency:    440,
+		Amplitude:    0.3,
+		PerCharacter: 5 * time.Millisecond,
+	}
+}
+
+func (s *Synthesizer) StreamPCM(ctx context.Context, text string, opts tts.Options, sampleRate int) (io.ReadCloser, error) {
+	s.mu.Lock()
+	s.texts = append(s.texts, text)
+	s.options = append(s.options, opts)
+	s.mu.Unlock()
+
+	duration := time.Duration(len(text)) * s.PerCharacter
+	pcm := Tone(s.Frequency, s.Amplitude, duration, sampleRate)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, pcm)
+	return io.NopCloser(&buf), nil
+}
+
+// Texts returns everything synthesized so far.
+func (s *Synthesizer) Texts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.texts...)
+}
+
+// Options returns the voice options of each synthesis so far.
+func (s *Synthesizer) Options() []tts.Options {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]tts.Options(nil), s.options...)
+}
+
+func (s *Synthesizer) ValidateVoice(ctx context.Context, voiceID string) error {
+	if len(s.Voices) == 0 || slices.Contains(s.Voices, voiceID) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", tts.ErrUnknownVoice, voiceID)
+}
+
+// Tone generates a sine wave at frequency Hz with peak amplitude given as a
+// fraction of full scale.
+func Tone(frequency, amplitude float64, duration time.Duration, sampleRate int) []int16 {
+	pcm := make([]int16, int(duration.Seconds()*float64(sampleRate)))
+	for i := range pcm {
+		phase := 2 * math.Pi * frequency * float64(i) / float64(sampleRate)
+		pcm[i] = int16(amplitude * 32767 * math.Sin(phase))
+	}
+	return pcm
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// iceCandidatePollTimeout is how long a candidate poll waits for the server
+// to gather something new before answering with nothing.
+const iceCandidatePollTimeout = 25 * time.Second
+
+// iceCandidatesResponse is the server's candidates after the ones the client
+// has already seen. Done is set once gathering has finished and no more
+// will follow.
+type iceCandidatesResponse struct {
+	Candidates []webrtc.ICECandidateInit `json:"candidates"`
+	Next       int                       `json:"next"`
+	Done       bool                      `json:"done"`
+}
+
+// handleICECandidates long-polls the server's ICE candidates for HTTP
+// clients that asked for a trickle answer. The client passes the next value
+// of its previous poll as after, starting from 0, until done. The candidates
+// are those gathered for the latest answer, so polling starts over from 0
+// after each one.
+func (s *Server) handleICECandidates(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	after := 0
+	if value := query.Get("after"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid after", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+
+	room, exists := s.roomManager.GetRoom(query.Get("room_id"))
+	if !exists {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	participant, exists := room.GetParticipant(query.Get("session_id"))
+	if !exists || participant.IsAgent {
+		http.Error(w, "Participant not found", http.StatusNotFound)
+		return
+	}
+
+	timeout := time.NewTimer(iceCandidatePollTimeout)
+	defer timeout.Stop()
+
+	for {
+		candidates, done, changed := participant.LocalCandidates(after)
+		if len(candidates) > 0 || done {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(iceCandidatesResponse{
+				Candidates: candidates,
+				Next:       after + len(candidates),
+				Done:       done,
+			})
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-timeout.C:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(iceCandidatesResponse{Candidates: []webrtc.ICECandidateInit{}, Next: after})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package llm holds the chat models the agent can talk to and the message
+// types shared between them.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"voice-agent/config"
+)
+
+// ChatModel streams chat completions. The message and tool types follow the
+// OpenAI chat format, which other vendors are adapted to.
+type ChatModel interface {
+	// StreamChatCompletion calls onDelta with each piece of reply content as
+	// it arrives and returns the complete assistant message, including any
+	// tool calls. Cancelling ctx aborts the stream.
+	StreamChatCompletion(ctx context.Context, messages []Message, systemPrompt string, tools []Tool, onDelta func(string)) (Message, error)
+}
+
+type Message struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+// Tool describes a function the model may call. Parameters is a JSON schema.
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+type FunctionDefinition struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters"`
+}
+
+// ToolCall is the model's request to run a tool. Arguments is a JSON object
+// encoded as a string.
+type ToolCall struct {
+	ID       string       `json:"id"`
+	Type     string       `json:"type"`
+	Function FunctionCall `json:"function"`
+}
+
+type FunctionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Factory creates a chat model from the service configuration.
+type Factory func(cfg *config.Config) (ChatModel, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a chat model available under name. Vendors register
+// themselves from init, so adding one needs no changes elsewhere.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// New creates the chat model registered under name.
+func New(name string, cfg *config.Config) (ChatModel, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown chat model provider %q (have %v)", name, Names())
+	}
+	return factory(cfg)
+}
+
+// Names lists the registered providers.
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
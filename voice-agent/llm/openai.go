@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"voice-agent/config"
+)
+
+const openAIBaseURL = "https://api.openai.com/v1"
+
+func init() {
+	Register("openai", func(cfg *config.Config) (ChatModel, error) {
+		return NewOpenAI(cfg.OpenAIKey), nil
+	})
+}
+
+type OpenAI struct {
+	apiKey  string
+	baseURL string
+	client  *http.Client
+}
+
+func NewOpenAI(apiKey string) *OpenAI {
+	return &OpenAI{
+		apiKey:  apiKey,
+		baseURL: openAIBaseURL,
+		client:  &http.Client{},
+	}
+}
+
+type ChatCompletionRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Tools    []Tool    `json:"tools,omitempty"`
+	Stream   bool      `json:"stream,omitempty"`
+}
+
+// ChatCompletionChunk is one server-sent event of a streamed completion.
+// Tool calls arrive in pieces keyed by Index and are joined by the caller.
+type ChatCompletionChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int          `json:"index"`
+				ID       string       `json:"id"`
+				Type     string       `json:"type"`
+				Function FunctionCall `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// StreamChatCompletion requests a streamed completion and calls onDelta with
+// each piece of content as it arrives. It returns the complete assistant
+// message, including any tool calls, once the stream ends; cancelling ctx
+// aborts the stream.
+func (o *OpenAI) StreamChatCompletion(ctx context.Context, messages []Message, systemPrompt string, tools []Tool, onDelta func(string)) (Message, error) {
+	allMessages := []Message{
+		{Role: "system", Content: systemPrompt},
+	}
+	allMessages = append(allMessages, messages...)
+
+	payload := ChatCompletionRequest{
+		Model:    "gpt-4",
+		Messages: allMessages,
+		Tools:    tools,
+		Stream:   true,
+	}
+
+	reply := Message{Role: "assistant"}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return reply, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/chat/completions", bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return reply, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return reply, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return reply, fmt.Errorf("OpenAI API error: %s", string(body))
+	}
+
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	done := false
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var chunk ChatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			reply.Content = content.String()
+			return reply, fmt.Errorf("invalid stream chunk: %w", err)
+		}
+
+		for _, choice := range chunk.Choices {
+			for _, part := range choice.Delta.ToolCalls {
+				for len(reply.ToolCalls) <= part.Index {
+					reply.ToolCalls = append(reply.ToolCalls, ToolCall{Type: "function"})
+				}
+				call := &reply.ToolCalls[part.Index]
+				if part.ID != "" {
+					call.ID = part.ID
+				}
+				call.Function.Name += part.Function.Name
+				call.Function.Arguments += part.Function.Arguments
+			}
+
+			if choice.Delta.Content != "" {
+				content.WriteString(choice.Delta.Content)
+				onDelta(choice.Delta.Content)
+			}
+		}
+	}
+
+	reply.Content = content.String()
+	if err := scanner.Err(); err != nil {
+		return reply, err
+	}
+	// A stream cut off before [DONE] holds only part of the reply.
+	if !done {
+		return reply, fmt.Errorf("stream ended before [DONE]: %w", io.ErrUnexpectedEOF)
+	}
+	return reply, nil
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// streamedReply is a completion that says a few words and then calls two
+// tools, the first one's arguments split across chunks. The line after
+// [DONE] is not JSON and must not be read.
+const streamedReply = `data: {"choices":[{"delta":{"role":"assistant","content":"Let me "}}]}
+
+data: {"choices":[{"delta":{"content":"check."}}]}
+
+: keep-alive
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"lookup_policy","arguments":""}}]}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"policy_"}}]}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"list_policy_members","arguments":"{}"}}]}}]}
+
+data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"number\":\"P-1\"}"}}]}}]}
+
+data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+
+data: not json
+`
+
+func TestStreamChatCompletion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("Authorization = %q", got)
+		}
+
+		var req ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		if !req.Stream || len(req.Tools) != 1 || len(req.Messages) != 2 || req.Messages[0].Role != "system" {
+			t.Errorf("request = %+v", req)
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(streamedReply))
+	}))
+	defer server.Close()
+
+	client := NewOpenAI("test-key")
+	client.baseURL = server.URL
+
+	tools := []Tool{{Type: "function", Function: FunctionDefinition{Name: "lookup_policy", Parameters: json.RawMessage(`{}`)}}}
+	var deltas []string
+	reply, err := client.StreamChatCompletion(context.Background(),
+		[]Message{{Role: "user", Content: "Is P-1 active?"}}, "Be brief.", tools,
+		func(delta string) { deltas = append(deltas, delta) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.Role != "assistant" || reply.Content != "Let me check." {
+		t.Errorf("reply = %+v", reply)
+	}
+	if strings.Join(deltas, "|") != "Let me |check." {
+		t.Errorf("deltas = %q", deltas)
+	}
+
+	want := []ToolCall{
+		{ID: "call_a", Type: "function", Function: FunctionCall{Name: "lookup_policy", Arguments: `{"policy_number":"P-1"}`}},
+		{ID: "call_b", Type: "function", Function: FunctionCall{Name: "list_policy_members", Arguments: `{}`}},
+	}
+	if len(reply.ToolCalls) != len(want) {
+		t.Fatalf("tool calls = %+v", reply.ToolCalls)
+	}
+	for i := range want {
+		if reply.ToolCalls[i] != want[i] {
+			t.Errorf("tool call %d = %+v, want %+v", i, reply.ToolCalls[i], want[i])
+		}
+	}
+}
+
+func TestStreamChatCompletionError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"Incorrect API key provided"}}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := NewOpenAI("bad-key")
+	client.baseURL = server.URL
+
+	_, err := client.StreamChatCompletion(context.Background(),
+		[]Message{{Role: "user", Content: "Hello?"}}, "", nil,
+		func(delta string) { t.Errorf("delta %q from an error", delta) })
+	if err == nil || !strings.Contains(err.Error(), "Incorrect API key provided") {
+		t.Errorf("error = %v", err)
+	}
+}
+
+func TestStreamChatCompletionBadChunk(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: {\"choices\":\n"))
+	}))
+	defer server.Close()
+
+	client := NewOpenAI("test-key")
+	client.baseURL = server.URL
+
+	reply, err := client.StreamChatCompletion(context.Background(),
+		[]Message{{Role: "user", Content: "Hello?"}}, "", nil, func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "invalid stream chunk") {
+		t.Errorf("error = %v", err)
+	}
+	if reply.Content != "Hi" {
+		t.Errorf("partial reply = %q", reply.Content)
+	}
+}
+
+func TestStreamChatCompletionTruncated(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Your policy \"}}]}\n\n"))
+	}))
+	defer server.Close()
+
+	client := NewOpenAI("test-key")
+	client.baseURL = server.URL
+
+	reply, err := client.StreamChatCompletion(context.Background(),
+		[]Message{{Role: "user", Content: "Is my policy active?"}}, "", nil, func(string) {})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("error = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if reply.Content != "Your policy " {
+		t.Errorf("partial reply = %q", reply.Content)
+	}
+}
@@ -1,20 +1,34 @@
 package main
 
 import (
-        "bytes"
+        "context"
         "encoding/json"
+        "errors"
         "fmt"
         "io"
         "log"
         "net/http"
+        "os"
+        "slices"
+        "strings"
         "sync"
+        "time"
+        "voice-agent/agent"
+        "voice-agent/brain"
         "voice-agent/config"
+        "voice-agent/llm"
+        "voice-agent/media"
         "voice-agent/models"
+        "voice-agent/recording"
         "voice-agent/room"
         "voice-agent/sfu"
         "voice-agent/signaling"
         "voice-agent/stt"
+        "voice-agent/summary"
+        "voice-agent/tools"
+        "voice-agent/transcripts"
         "voice-agent/tts"
+        "voice-agent/vad"
 
         "github.com/google/uuid"
         "github.com/pion/webrtc/v4"
@@ -25,36 +39,126 @@ type Server struct {
         roomManager     *room.Manager
         sfuServer       *sfu.SFU
         signalingServer *signaling.SignalingServer
-        ttsClient       *tts.ElevenLabs
-        sttClient       *stt.OpenAISTT
+        transcriber     stt.Transcriber
+        synthesizer     tts.Synthesizer
+        chatModel       llm.ChatModel
+        vocabulary      *stt.Vocabulary
+        ttsCache        *tts.Cache
+        transcriptStore transcripts.Store
+        newEncoder      func(sampleRate, channels int) (media.Encoder, error)
+        newDecoder      func(sampleRate, channels int) (media.Decoder, error)
+        toolRegistry    *tools.Registry
         sttBuffersMu    sync.Mutex
-        sttBuffers      map[string]*bytes.Buffer // key: sessionID
+        sttBuffers      map[string]*media.Segmenter // key: sessionID
+        agentsMu        sync.Mutex
+        agents          map[string]*agent.Session // key: roomID
 }
 
 func main() {
         cfg := config.Load()
-        
+
+        server, err := newServer(cfg)
+        if err != nil {
+                log.Fatal(err)
+        }
+
+        if len(os.Args) > 1 && os.Args[1] == "prewarm" {
+                if err := server.prewarm(context.Background()); err != nil {
+                        log.Fatal(err)
+                }
+                return
+        }
+
+        // Without libopus callers could neither hear the agent nor be
+        // understood, so refuse to serve.
+        if _, err := media.NewEncoder(media.OpusSampleRate, 1); err != nil {
+                log.Fatalf("Agent playback unavailable: %v", err)
+        }
+        if _, err := media.NewDecoder(media.IngestSampleRate, 1); err != nil {
+                log.Fatalf("Caller audio unavailable: %v", err)
+        }
+
+        addr := fmt.Sprintf(":%s", cfg.ServerPort)
+        log.Printf("Voice agent server starting on %s", addr)
+        log.Fatal(http.ListenAndServe(addr, server.routes()))
+}
+
+func newServer(cfg *config.Config) (*Server, error) {
         server := &Server{
                 config:          cfg,
                 roomManager:     room.NewManager(),
                 sfuServer:       sfu.NewSFU(cfg),
-                signalingServer: signaling.NewSignalingServer(),
-                ttsClient:       tts.NewElevenLabs(cfg.ElevenLabsKey),
-                sttClient:       stt.NewOpenAISTT(cfg.OpenAIKey),
-                sttBuffers:      make(map[string]*bytes.Buffer),
+                toolRegistry:    tools.NewRegistry(),
+                newEncoder:      media.NewEncoder,
+                newDecoder:      media.NewDecoder,
+                sttBuffers:      make(map[string]*media.Segmenter),
+                agents:          make(map[string]*agent.Session),
         }
+        server.signalingServer = signaling.NewSignalingServer(cfg, server.roomManager, server.sfuServer)
 
-        http.HandleFunc("/api/voice/start", server.handleStartVoiceSession)
-        http.HandleFunc("/api/voice/ws", server.handleWebSocket)
-        http.HandleFunc("/api/voice/offer", server.handleOffer)
-        http.HandleFunc("/api/voice/answer", server.handleAnswer)
-        http.HandleFunc("/api/voice/ice-candidate", server.handleICECandidate)
-        http.HandleFunc("/api/voice/stt", server.handleSTT)
-        http.HandleFunc("/health", server.handleHealth)
+        var err error
+        if server.transcriber, err = stt.New(cfg.STTProvider, cfg); err != nil {
+                return nil, err
+        }
+        if server.synthesizer, err = tts.New(cfg.TTSProvider, cfg); err != nil {
+                return nil, err
+        }
+        if server.chatModel, err = llm.New(cfg.LLMProvider, cfg); err != nil {
+                return nil, err
+        }
 
-        addr := fmt.Sprintf(":%s", cfg.ServerPort)
-        log.Printf("Voice agent server starting on %s", addr)
-        log.Fatal(http.ListenAndServe(addr, nil))
+        if cfg.TranscriptStore != "" {
+                if server.transcriptStore, err = transcripts.New(cfg.TranscriptStore, cfg); err != nil {
+                        return nil, err
+                }
+        }
+
+        if cfg.TTSCacheDir != "" {
+                cache, err := tts.NewCache(server.synthesizer, cfg.TTSCacheDir, int64(cfg.TTSCacheMaxMB)<<20)
+                if err != nil {
+                        log.Printf("TTS cache disabled: %v", err)
+                } else {
+                        // Replies often read back policy details, so only the
+                        // agent's fixed phrases are kept on disk.
+                        cache.Keep(server.fixedPhrases()...)
+                        server.ttsCache = cache
+                        server.synthesizer = cache.Synthesizer()
+                }
+        }
+
+        // Missing policy data is a deployment mistake, not a reason to run
+        // without policy lookups, so only leaving the paths empty turns them off.
+        if server.vocabulary, err = stt.LoadVocabulary(cfg.PoliciesPath, cfg.STTVocabularyDocs); err != nil {
+                return nil, fmt.Errorf("loading STT vocabulary (POLICIES_PATH, STT_VOCABULARY_DOCS): %w", err)
+        }
+
+        if cfg.PoliciesPath == "" {
+                log.Printf("Policy lookup tools disabled: POLICIES_PATH is empty")
+        } else {
+                policies, err := tools.LoadPolicies(cfg.PoliciesPath)
+                if err != nil {
+                        return nil, fmt.Errorf("loading policies (POLICIES_PATH): %w", err)
+                }
+                tools.RegisterPolicyTools(server.toolRegistry, policies)
+        }
+
+        return server, nil
+}
+
+func (s *Server) routes() *http.ServeMux {
+        mux := http.NewServeMux()
+        mux.HandleFunc("/api/voice/start", s.handleStartVoiceSession)
+        mux.HandleFunc("/api/voice/ws", s.handleWebSocket)
+        mux.HandleFunc("/api/voice/offer", s.handleOffer)
+        mux.HandleFunc("/api/voice/answer", s.handleAnswer)
+        mux.HandleFunc("/api/voice/ice-candidate", s.handleICECandidate)
+        mux.HandleFunc("GET /api/voice/ice-candidates", s.handleICECandidates)
+        mux.HandleFunc("/api/voice/stt", s.handleSTT)
+        mux.HandleFunc("/api/voice/stt/stream", s.handleSTTStream)
+        mux.HandleFunc("GET /api/voice/rooms/{id}/transcript", s.handleTranscript)
+        mux.HandleFunc("GET /api/voice/rooms/{id}/summary", s.handleSummary)
+        mux.HandleFunc("/health", s.handleHealth)
+        return mux
 }
 
 func (s *Server) handleStartVoiceSession(w http.ResponseWriter, r *http.Request) {
@@ -74,6 +178,48 @@ func (s *Server) handleStartVoiceSession(w http.ResponseWriter, r *http.Request)
                 return
         }
 
+        language := s.config.AgentLanguage
+        if req.Language != "" {
+                language = req.Language
+        }
+        if !agent.SupportedLanguage(language) {
+                http.Error(w, fmt.Sprintf("Unsupported language %q", language), http.StatusBadRequest)
+                return
+        }
+
+        var requested tts.Options
+        if req.Voice != nil {
+                requested = ttsOptions(*req.Voice)
+        }
+        voice := s.defaultVoice().Merge(requested)
+
+        // Each language's voice keeps whatever the session chose itself.
+        voices := s.languageVoices()
+        for lang, languageVoice := range voices {
+                voices[lang] = languageVoice.Merge(requested)
+        }
+
+        // Every voice the call may speak in is checked now, configured ones
+        // included, rather than failing partway through the call.
+        for _, voiceID := range sessionVoiceIDs(voice, voices) {
+                if err := s.validateVoice(r.Context(), voiceID); err != nil {
+                        if voiceID == requested.VoiceID {
+                                http.Error(w, err.Error(), http.StatusBadRequest)
+                        } else {
+                                log.Printf("Configured voice %s unavailable: %v", voiceID, err)
+                                http.Error(w, "Configured voice unavailable", http.StatusInternalServerError)
+                        }
+                        return
+                }
+        }
+
+        call := callOptions{
+                voice:      voice,
+                language:   language,
+                voices:     voices,
+                vocabulary: s.vocabulary.With(req.Vocabulary...),
+        }
+
         newRoom := s.roomManager.CreateRoom()
         sessionID := uuid.New().String()
 
@@ -102,7 +248,7 @@ func (s *Server) handleStartVoiceSession(w http.ResponseWriter, r *http.Request)
 
         newRoom.AddParticipant(agentParticipant)
 
-        go s.runVoiceAgent(newRoom, agentParticipant, userParticipant)
+        go s.runVoiceAgent(newRoom, agentParticipant, userParticipant, call)
 
         response := models.PhoneNumberResponse{
                 SessionID: sessionID,
@@ -124,6 +270,10 @@ func (s *Server) handleOffer(w http.ResponseWriter, r *http.Request) {
                 SessionID string                     `json:"session_id"`
                 RoomID    string                     `json:"room_id"`
                 Offer     *webrtc.SessionDescription `json:"offer"`
+                // Trickle asks for the answer without waiting for ICE
+                // gathering; the server's candidates are then polled from
+                // /api/voice/ice-candidates.
+                Trickle   bool                       `json:"trickle"`
         }
 
         if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
@@ -150,8 +300,14 @@ func (s *Server) handleOffer(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
+        trickle := msg.Trickle && s.config.ICETrickle
+        createAnswer := s.sfuServer.CreateAnswer
+        if trickle {
+                createAnswer = s.sfuServer.CreateTrickleAnswer
+        }
+
         log.Printf("Creating answer for session %s in room %s", msg.SessionID, msg.RoomID)
-        answer, err := s.sfuServer.CreateAnswer(participant.PeerConnection, *msg.Offer)
+        answer, err := createAnswer(participant.PeerConnection, *msg.Offer)
         if err != nil {
                 http.Error(w, fmt.Sprintf("Failed to create answer: %v", err), http.StatusInternalServerError)
                 return
@@ -160,7 +316,8 @@ func (s *Server) handleOffer(w http.ResponseWriter, r *http.Request) {
 
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(map[string]interface{}{
-                "answer": answer,
+                "answer":  answer,
+                "trickle": trickle,
         })
 }
 
@@ -252,8 +409,15 @@ func (s *Server) handleSTT(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
+        // Audio is buffered and transcribed per session, so only the room's
+        // caller may send it. The room's agent hears the caller over RTP,
+        // where turns end at a pause; cuts made here end at a byte count.
         sessionID := r.Header.Get("X-Session-ID")
         roomID := r.Header.Get("X-Room-ID")
+        if s.sttCaller(w, roomID, sessionID) == nil {
+                return
+        }
+        language := sttLanguage(r.Header.Get("X-Language"))
 
         audioData, err := io.ReadAll(r.Body)
         if err != nil || len(audioData) == 0 {
@@ -261,7 +425,7 @@ func (s *Server) handleSTT(w http.ResponseWriter, r *http.Request) {
                 return
         }
 
-        if s.config.OpenAIKey == "" {
+        if s.config.STTProvider == "openai" && s.config.OpenAIKey == "" {
                 log.Printf("STT[%s/%s]: missing OPENAI_API_KEY; received %d bytes", roomID, sessionID, len(audioData))
                 http.Error(w, "STT not configured: missing OPENAI_API_KEY", http.StatusInternalServerError)
                 return
@@ -269,37 +433,46 @@ func (s *Server) handleSTT(w http.ResponseWriter, r *http.Request) {
 
         log.Printf("STT[%s/%s]: received %d bytes", roomID, sessionID, len(audioData))
 
-        // Buffer chunks per session to form a valid file before sending to OpenAI
+        // MediaRecorder chunks are only decodable together with the stream's
+        // header, so each session's recording is cut into whole files.
         s.sttBuffersMu.Lock()
-        buf, ok := s.sttBuffers[sessionID]
+        segmenter, ok := s.sttBuffers[sessionID]
         if !ok {
-                buf = &bytes.Buffer{}
-                s.sttBuffers[sessionID] = buf
+                segmenter = media.NewSegmenter()
+                s.sttBuffers[sessionID] = segmenter
+        }
+        if _, err := segmenter.Write(audioData); err != nil {
+                delete(s.sttBuffers, sessionID)
+                s.sttBuffersMu.Unlock()
+                log.Printf("STT[%s/%s]: %v", roomID, sessionID, err)
+                http.Error(w, "Invalid audio data", http.StatusBadRequest)
+                return
         }
-        buf.Write(audioData)
-        currentSize := buf.Len()
-        s.sttBuffersMu.Unlock()
 
-        // Only transcribe when enough audio accumulated (e.g., > 60KB)
-        if currentSize < 60000 {
+        // Only transcribe when enough audio accumulated
+        if segmenter.Buffered() < sttBatchBytes {
+                s.sttBuffersMu.Unlock()
                 w.WriteHeader(http.StatusNoContent)
                 return
         }
 
-        // Snapshot and reset buffer for next batch
-        s.sttBuffersMu.Lock()
-        audioToSend := make([]byte, buf.Len())
-        copy(audioToSend, buf.Bytes())
-        buf.Reset()
+        audioToSend := segmenter.Cut()
+        filename := segmenter.Filename()
         s.sttBuffersMu.Unlock()
 
-        text, err := s.sttClient.TranscribeAudio(audioToSend, "en")
+        text, unclear, err := s.transcribe(r.Context(), audioToSend, filename, stt.Options{Language: language, Prompt: s.vocabulary.Prompt()})
         if err != nil {
                 log.Printf("STT error: %v", err)
                 http.Error(w, "STT failed", http.StatusInternalServerError)
                 return
         }
 
+        if unclear {
+                w.Header().Set("Content-Type", "application/json")
+                json.NewEncoder(w).Encode(map[string]interface{}{"text": "", "unclear": true})
+                return
+        }
+
         if text == "" {
                 w.Header().Set("Content-Type", "application/json")
                 json.NewEncoder(w).Encode(map[string]string{"text": ""})
@@ -312,6 +485,121 @@ func (s *Server) handleSTT(w http.ResponseWriter, r *http.Request) {
         json.NewEncoder(w).Encode(map[string]string{"text": text})
 }
 
+// transcribe returns the speech in audio, leaving out anything the
+// transcriber reports it made up for silence. Speech too unclear to act on
+// is reported as unclear rather than returned.
+func (s *Server) transcribe(ctx context.Context, audio []byte, filename string, opts stt.Options) (text string, unclear bool, err error) {
+        speech, unclear, err := s.transcribeSpeech(ctx, audio, filename, opts)
+        if err != nil {
+                return "", false, err
+        }
+        return speech.Text, unclear, nil
+}
+
+// transcribeSpeech is transcribe returning the speech with its timings, for
+// callers that need to know where in the audio it was. The text is empty
+// when the speech is unclear.
+func (s *Server) transcribeSpeech(ctx context.Context, audio []byte, filename string, opts stt.Options) (speech *stt.Transcript, unclear bool, err error) {
+        transcript, err := stt.TranscribeDetailed(ctx, s.transcriber, audio, filename, opts)
+        if err != nil {
+                return nil, false, err
+        }
+
+        speech = transcript.Speech()
+        speech.Text = strings.TrimSpace(speech.Text)
+        if reason := s.sttThresholds().Unclear(speech); speech.Text != "" && reason != "" {
+                log.Printf("STT: dropping unclear transcript (%s): %q", reason, speech.Text)
+                speech.Text = ""
+                return speech, true, nil
+        }
+        return speech, false, nil
+}
+
+// sttCaller returns the participant a transcription request speaks for,
+// which must be the caller in the room, not its agent. Otherwise it answers
+// the request with an error and returns nil.
+func (s *Server) sttCaller(w http.ResponseWriter, roomID, sessionID string) *models.Participant {
+        if roomID == "" || sessionID == "" {
+                http.Error(w, "Session and room IDs are required", http.StatusBadRequest)
+                return nil
+        }
+
+        room, exists := s.roomManager.GetRoom(roomID)
+        if !exists {
+                http.Error(w, "Room not found", http.StatusNotFound)
+                return nil
+        }
+        participant, exists := room.GetParticipant(sessionID)
+        if !exists || participant.IsAgent {
+                http.Error(w, "Not the caller in this room", http.StatusForbidden)
+                return nil
+        }
+        return participant
+}
+
+func (s *Server) sttThresholds() stt.Thresholds {
+        return stt.Thresholds{
+                MinConfidence: s.config.STTMinConfidence,
+                MinLetters:    s.config.STTMinLetters,
+        }
+}
+
+// handleTranscript returns a call's stored transcript, during the call or
+// after it has ended.
+func (s *Server) handleTranscript(w http.ResponseWriter, r *http.Request) {
+        if s.transcriptStore == nil {
+                http.Error(w, "Transcript storage is disabled", http.StatusServiceUnavailable)
+                return
+        }
+
+        roomID := r.PathValue("id")
+        entries, err := s.transcriptStore.Room(r.Context(), roomID)
+        if errors.Is(err, transcripts.ErrInvalidRoomID) {
+                http.Error(w, "Invalid room ID", http.StatusBadRequest)
+                return
+        }
+        if err != nil {
+                log.Printf("Transcript[%s]: %v", roomID, err)
+                http.Error(w, "Failed to read transcript", http.StatusInternalServerError)
+                return
+        }
+        if len(entries) == 0 {
+                http.Error(w, "Transcript not found", http.StatusNotFound)
+                return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(models.TranscriptResponse{RoomID: roomID, Messages: entries})
+}
+
+// handleSummary returns the write-up of a finished call. It is not found
+// until the call has ended and been summarized.
+func (s *Server) handleSummary(w http.ResponseWriter, r *http.Request) {
+        if s.transcriptStore == nil {
+                http.Error(w, "Transcript storage is disabled", http.StatusServiceUnavailable)
+                return
+        }
+
+        roomID := r.PathValue("id")
+        callSummary, err := s.transcriptStore.Summary(r.Context(), roomID)
+        if errors.Is(err, transcripts.ErrInvalidRoomID) {
+                http.Error(w, "Invalid room ID", http.StatusBadRequest)
+                return
+        }
+        if err != nil {
+                log.Printf("Summary[%s]: %v", roomID, err)
+                http.Error(w, "Failed to read summary", http.StatusInternalServerError)
+                return
+        }
+        if callSummary == nil {
+                http.Error(w, "Summary not found", http.StatusNotFound)
+                return
+        }
+
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(callSummary)
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "application/json")
         json.NewEncoder(w).Encode(map[string]string{
@@ -320,57 +608,345 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
         })
 }
 
-func (s *Server) runVoiceAgent(room *models.Room, agent *models.Participant, user *models.Participant) {
-        log.Printf("Voice agent started for room %s", room.ID)
+func (s *Server) vadConfig(sampleRate int) vad.Config {
+        cfg := vad.DefaultConfig(sampleRate)
+        cfg.SpeechThreshold = s.config.VADSpeechThreshold
+        cfg.SilenceThreshold = s.config.VADSilenceThreshold
+        cfg.MinSpeech = time.Duration(s.config.VADMinSpeechMs) * time.Millisecond
+        cfg.Hangover = time.Duration(s.config.VADHangoverMs) * time.Millisecond
+        return cfg
+}
 
-        // Voice-optimized system prompt based on LiveKit/Vapi best practices
-        systemPrompt := `You are a helpful insurance assistant in a voice call.
+// prewarm fills the TTS cache with the greeting and the phrases listed in
+// the prewarm file, spoken in the default voice.
+func (s *Server) prewarm(ctx context.Context) error {
+        if s.ttsCache == nil {
+                return errors.New("TTS cache is disabled; set TTS_CACHE_DIR")
+        }
+
+        // The agent's own phrases are warmed in every language, in the voice
+        // used for it; the prewarm file is English.
+        voices := s.languageVoices()
+        count := 0
+        for language, languagePhrases := range agent.Languages {
+                voice := s.defaultVoice().Merge(voices[language])
+                phrases := append([]string{languagePhrases.Greeting, languagePhrases.Escalation}, languagePhrases.Clarifications...)
+                if language == "en" {
+                        phrases = append(phrases, s.prewarmFilePhrases()...)
+                }
 
-## Style Guardrails
-- Keep responses under 2 sentences (max 280 characters)
-- Be warm, empathetic, and conversational
-- Use natural speech - be direct and clear
-- If the answer is complex, give the most important point first, then ask if they want more details
+                sampleRate := tts.PCMSampleRate(voice.OutputFormat, agent.DefaultSampleRate)
+                if err := s.ttsCache.Prewarm(ctx, phrases, voice, sampleRate); err != nil {
+                        return err
+                }
+                count += len(phrases)
+        }
+        log.Printf("TTS cache prewarmed with %d phrases in %s", count, s.config.TTSCacheDir)
+        return nil
+}
 
-## Goal
-Answer insurance policy questions quickly and accurately.
+// fixedPhrases are the phrases the TTS cache keeps: the agent's own phrases
+// in every language and the prewarm file's.
+func (s *Server) fixedPhrases() []string {
+        var phrases []string
+        for _, languagePhrases := range agent.Languages {
+                phrases = append(phrases, languagePhrases.Greeting, languagePhrases.Escalation)
+                phrases = append(phrases, languagePhrases.Clarifications...)
+        }
+        return append(phrases, s.prewarmFilePhrases()...)
+}
 
-## Tool Usage
-- For policy questions: retrieve policy info first, then answer
-- For claims: provide direct contact info or next steps
+// prewarmFilePhrases reads the prewarm file, skipping blank lines and
+// comments.
+func (s *Server) prewarmFilePhrases() []string {
+        var phrases []string
+        if data, err := os.ReadFile(s.config.TTSPrewarmFile); err != nil {
+                log.Printf("No prewarm phrases loaded: %v", err)
+        } else {
+                for _, line := range strings.Split(string(data), "\n") {
+                        if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+                                phrases = append(phrases, line)
+                        }
+                }
+        }
+        return phrases
+}
 
-## Example Responses
-User: "What's covered in my policy?"
-You: "Your policy covers hospitalization up to your sum insured, plus 60 days pre and post hospitalization. Want details on specific benefits?"
+// languageVoices are the TTS options layered over the agent voice for each
+// language other than English.
+func (s *Server) languageVoices() map[string]tts.Options {
+        return map[string]tts.Options{
+                "hi": {VoiceID: s.config.TTSHindiVoiceID, ModelID: s.config.TTSHindiModelID},
+        }
+}
 
-User: "How do I make a claim?"
-You: "Call customer care or file online through the portal. Need the customer care number?"
-`
+// sttLanguage turns a requested language into a transcription hint: none
+// for "auto", so the transcriber detects it, and English when unset or
+// unsupported.
+func sttLanguage(requested string) string {
+        switch {
+        case requested == agent.AutoLanguage:
+                return ""
+        case requested != "" && agent.SupportedLanguage(requested):
+                return requested
+        }
+        return "en"
+}
 
-        conversationHistory := []stt.Message{}
-        
-        _ = systemPrompt
-        _ = conversationHistory
+// defaultVoice is the agent voice from config.
+func (s *Server) defaultVoice() tts.Options {
+        stability := s.config.TTSStability
+        similarityBoost := s.config.TTSSimilarityBoost
+        return tts.Options{
+                VoiceID:      s.config.TTSVoiceID,
+                ModelID:      s.config.TTSModelID,
+                OutputFormat: s.config.TTSOutputFormat,
+                Speed:        s.config.TTSSpeed,
+                Settings: &tts.VoiceSettings{
+                        Stability:       &stability,
+                        SimilarityBoost: &similarityBoost,
+                },
+        }
+}
 
-        greetingText := fmt.Sprintf("Hi! I'm your insurance assistant calling about %s. How can I help with your policy today?", 
-                user.PhoneNumber)
+// ttsOptions converts a session's voice request to synthesizer options.
+func ttsOptions(v models.VoiceRequest) tts.Options {
+        opts := tts.Options{
+                VoiceID:      v.VoiceID,
+                ModelID:      v.ModelID,
+                OutputFormat: v.OutputFormat,
+                Speed:        v.Speed,
+        }
+        if v.Settings != nil {
+                opts.Settings = &tts.VoiceSettings{
+                        Stability:       v.Settings.Stability,
+                        SimilarityBoost: v.Settings.SimilarityBoost,
+                        Style:           v.Settings.Style,
+                        UseSpeakerBoost: v.Settings.UseSpeakerBoost,
+                }
+        }
+        return opts
+}
 
-        if agent.DataChannel != nil {
-                transcriptMsg := models.TranscriptMessage{
-                        Type:    "transcript",
-                        Speaker: "agent",
-                        Text:    greetingText,
+// sessionVoiceIDs lists the distinct voices a call may speak in: its own
+// and any language voice that replaces it.
+func sessionVoiceIDs(voice tts.Options, voices map[string]tts.Options) []string {
+        ids := []string{voice.VoiceID}
+        for _, languageVoice := range voices {
+                if id := languageVoice.VoiceID; id != "" && !slices.Contains(ids, id) {
+                        ids = append(ids, id)
                 }
-                data, _ := json.Marshal(transcriptMsg)
-                agent.DataChannel.SendText(string(data))
         }
+        return ids
+}
 
-        audioStream, err := s.ttsClient.StreamSpeech(greetingText, "1qEiC6qsybMkmnNdVMbK")
+// validateVoice rejects voices the TTS provider does not have. When the
+// provider cannot list its voices the session goes ahead with a warning.
+func (s *Server) validateVoice(ctx context.Context, voiceID string) error {
+        validator, ok := s.synthesizer.(tts.VoiceValidator)
+        if !ok {
+                return nil
+        }
+
+        err := validator.ValidateVoice(ctx, voiceID)
+        if errors.Is(err, tts.ErrVoiceListUnavailable) {
+                log.Printf("Voice %s not validated: %v", voiceID, err)
+                return nil
+        }
+        return err
+}
+
+// newBrain creates the configured reply backend for one caller.
+func (s *Server) newBrain(user *models.Participant) brain.Brain {
+        switch s.config.AgentBrain {
+        case "python":
+                return brain.NewVoiceStream(s.config.PythonAPIURL, user.PhoneNumber)
+        case "llm":
+        default:
+                log.Printf("Unknown AGENT_BRAIN %q, using llm", s.config.AgentBrain)
+        }
+        return brain.NewChat(s.chatModel, s.toolRegistry, brain.CallerPrompt(user.PhoneNumber))
+}
+
+func (s *Server) agentForRoom(roomID string) *agent.Session {
+        s.agentsMu.Lock()
+        defer s.agentsMu.Unlock()
+        return s.agents[roomID]
+}
+
+// callOptions are the per-call settings chosen when a voice session starts.
+type callOptions struct {
+        voice      tts.Options
+        language   string
+        voices     map[string]tts.Options
+        vocabulary *stt.Vocabulary
+}
+
+func (s *Server) runVoiceAgent(room *models.Room, agentParticipant *models.Participant, user *models.Participant, call callOptions) {
+        log.Printf("Voice agent started for room %s", room.ID)
+
+        ctx, cancel := context.WithTimeout(context.Background(), time.Duration(s.config.SessionTimeout)*time.Second)
+        defer cancel()
+
+        // The call is over once the caller's connection is gone.
+        connected := make(chan struct{})
+        var connectedOnce sync.Once
+        user.PeerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+                switch state {
+                case webrtc.PeerConnectionStateConnected:
+                        connectedOnce.Do(func() { close(connected) })
+                case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+                        cancel()
+                }
+        })
+        if user.PeerConnection.ConnectionState() == webrtc.PeerConnectionStateConnected {
+                connectedOnce.Do(func() { close(connected) })
+        }
+
+        // The call is recorded as it was sent: the caller's packets as they
+        // arrive and the agent's as they are played.
+        recorder := s.startRecording(room.ID)
+        var agentTrack media.RTPWriter = user.AudioTrack
+        if recorder != nil {
+                user.AddRTPSink(recorder.Track(user.ID, recording.User))
+                agentTrack = media.MultiRTPWriter(user.AudioTrack, recorder.Track(agentParticipant.ID, recording.Agent))
+        }
+
+        // The agent talks on the caller's outbound track. A call the caller
+        // cannot hear is ended rather than run silently.
+        var speaker agent.Speaker
+        var setupErr error
+        if encoder, err := s.newEncoder(media.OpusSampleRate, 1); err != nil {
+                setupErr = fmt.Errorf("agent playback unavailable: %w", err)
+        } else {
+                speaker = media.NewEgress(agentTrack, encoder)
+        }
+
+        session := agent.NewSession(room, agentParticipant, user, s.transcriber, s.synthesizer, s.newBrain(user), speaker)
+        session.SetVoice(call.voice)
+        session.SetLanguage(call.language, call.voices)
+        session.SetVocabulary(call.vocabulary)
+        session.SetClarification(s.sttThresholds(), s.config.AgentMaxClarifications)
+        session.SetTranscriptStore(s.transcriptStore)
+        session.OnStateChange(func(state string) {
+                s.signalingServer.SendAgentState(user.ID, state)
+        })
+
+        // Nor is a call run where the agent cannot hear the caller.
+        if decoder, err := s.newDecoder(media.IngestSampleRate, 1); err != nil {
+                if setupErr == nil {
+                        setupErr = fmt.Errorf("caller audio unavailable: %w", err)
+                }
+        } else {
+                ingest := media.NewIngest(decoder)
+                defer ingest.Close()
+                user.AddRTPSink(ingest)
+                go session.ListenTrack(ctx, ingest.Frames(), vad.New(s.vadConfig(media.IngestSampleRate)), media.IngestSampleRate)
+        }
+
+        s.agentsMu.Lock()
+        s.agents[room.ID] = session
+        s.agentsMu.Unlock()
+
+        // Anything said before the caller's media path is up would be lost,
+        // so the greeting waits for the connection.
+        var err error
+        if setupErr != nil {
+                err = setupErr
+        } else {
+                select {
+                case <-connected:
+                        err = session.Run(ctx)
+                case <-ctx.Done():
+                        err = ctx.Err()
+                }
+        }
+        log.Printf("Voice agent stopped for room %s: %v", room.ID, err)
+        s.signalingServer.Hangup(user.ID, hangupReason(err))
+
+        s.agentsMu.Lock()
+        delete(s.agents, room.ID)
+        s.agentsMu.Unlock()
+
+        s.sttBuffersMu.Lock()
+        delete(s.sttBuffers, user.ID)
+        s.sttBuffersMu.Unlock()
+
+        for _, p := range room.GetParticipants() {
+                if p.PeerConnection != nil {
+                        p.PeerConnection.Close()
+                }
+        }
+        s.roomManager.DeleteRoom(room.ID)
+
+        if recorder != nil {
+                if _, err := recorder.Close(); err != nil {
+                        log.Printf("Recording of room %s failed: %v", room.ID, err)
+                } else {
+                        log.Printf("Call in room %s recorded to %s", room.ID, recorder.Dir())
+                }
+        }
+
+        s.summarizeCall(room.ID)
+}
+
+// hangupReason tells the caller's client why the agent ended the call.
+func hangupReason(err error) string {
+        switch {
+        case errors.Is(err, context.DeadlineExceeded):
+                return "session_timeout"
+        case err == nil || errors.Is(err, context.Canceled):
+                return "call_ended"
+        default:
+                return "agent_error"
+        }
+}
+
+// summarizeCall writes up a finished call from its stored transcript and
+// stores the summary with it.
+func (s *Server) summarizeCall(roomID string) {
+        if s.transcriptStore == nil || !s.config.CallSummaries {
+                return
+        }
+
+        ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+        defer cancel()
+
+        entries, err := s.transcriptStore.Room(ctx, roomID)
+        if err != nil {
+                log.Printf("Summary of room %s failed: %v", roomID, err)
+                return
+        }
+        if len(entries) == 0 {
+                return
+        }
+
+        callSummary, err := summary.New(s.chatModel).Summarize(ctx, entries)
         if err != nil {
-                log.Printf("TTS error: %v", err)
+                log.Printf("Summary of room %s failed: %v", roomID, err)
                 return
         }
-        defer audioStream.Close()
+        if err := s.transcriptStore.SaveSummary(ctx, *callSummary); err != nil {
+                log.Printf("Summary of room %s not stored: %v", roomID, err)
+                return
+        }
+        log.Printf("Call in room %s summarized: %s", roomID, callSummary.Disposition)
+}
 
-        log.Printf("Voice agent running for room %s", room.ID)
+// startRecording begins recording a call. It returns nil when recording is
+// disabled or cannot start, and the call goes ahead unrecorded.
+func (s *Server) startRecording(roomID string) *recording.Recorder {
+        if s.config.RecordingDir == "" {
+                return nil
+        }
+
+        recorder, err := recording.New(s.config.RecordingDir, roomID)
+        if err != nil {
+                log.Printf("Recording disabled for room %s: %v", roomID, err)
+                return nil
+        }
+        if s.config.RecordingMix {
+                recorder.EnableMix(s.newDecoder)
+        }
+        return recorder
 }
@@ -0,0 +1,1396 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"voice-agent/agent"
+	"voice-agent/config"
+	"voice-agent/fake"
+	"voice-agent/media"
+	"voice-agent/models"
+	"voice-agent/recording"
+	"voice-agent/signaling"
+	"voice-agent/transcripts"
+	"voice-agent/tts"
+	"voice-agent/vad"
+
+	"github.com/gorilla/websocket"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+)
+
+// loudLevel is the dBFS a received frame must reach to count as agent speech.
+// Fake tones sit around -13 dBFS and silence at -120.
+const loudLevel = -30
+
+// testHarness runs the voice server over HTTP with fake providers.
+type testHarness struct {
+	t           *testing.T
+	server      *Server
+	http        *httptest.Server
+	transcriber *fake.Transcriber
+	synthesizer *fake.Synthesizer
+	chatModel   *fake.ChatModel
+}
+
+func newTestHarness(t *testing.T, transcripts, replies []string) *testHarness {
+	t.Helper()
+
+	cfg := config.Load()
+	cfg.STUNServers = nil
+	cfg.TURNServers = nil
+	cfg.ICEIncludeLoopback = true
+	cfg.PoliciesPath = ""
+	cfg.STTVocabularyDocs = ""
+	cfg.TTSCacheDir = ""
+	cfg.RecordingDir = ""
+	cfg.TranscriptStore = ""
+	cfg.VADHangoverMs = 300
+	cfg.AgentBrain = "llm"
+
+	server, err := newServer(cfg)
+	if err != nil {
+		t.Fatalf("newServer: %v", err)
+	}
+
+	h := &testHarness{
+		t:           t,
+		server:      server,
+		transcriber: fake.NewTranscriber(transcripts...),
+		synthesizer: fake.NewSynthesizer(),
+		chatModel:   fake.NewChatModel(replies...),
+	}
+	server.transcriber = h.transcriber
+	server.synthesizer = h.synthesizer
+	server.chatModel = h.chatModel
+	server.newEncoder = fake.NewEncoder
+	server.newDecoder = fake.NewDecoder
+
+	h.http = httptest.NewServer(server.routes())
+	t.Cleanup(h.http.Close)
+	return h
+}
+
+func (h *testHarness) post(path string, body, result interface{}) {
+	h.t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		h.t.Fatalf("marshal %s request: %v", path, err)
+	}
+
+	resp, err := http.Post(h.http.URL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		h.t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		h.t.Fatalf("POST %s: %s: %s", path, resp.Status, msg.String())
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			h.t.Fatalf("decode %s response: %v", path, err)
+		}
+	}
+}
+
+// testCaller is a browser stand-in: a pion peer connection that sends a
+// live microphone stream, plays nothing but measures what it hears, and
+// collects transcripts from the data channel.
+type testCaller struct {
+	t       *testing.T
+	session models.PhoneNumberResponse
+	pc      *webrtc.PeerConnection
+	track   *webrtc.TrackLocalStaticRTP
+
+	connected   chan struct{}
+	transcripts chan models.TranscriptMessage
+
+	mu         sync.Mutex
+	mic        []int16
+	lastPacket time.Time
+	loudFrames int
+}
+
+// call starts a voice session and connects to it, trickling the caller's ICE
+// candidates after the offer.
+func (h *testHarness) call(phoneNumber string) *testCaller {
+	h.t.Helper()
+	return h.callWith(models.PhoneNumberRequest{PhoneNumber: phoneNumber})
+}
+
+func (h *testHarness) callWith(start models.PhoneNumberRequest) *testCaller {
+	h.t.Helper()
+
+	c, candidates := h.newCaller(start)
+	offer, err := c.pc.CreateOffer(nil)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	if err := c.pc.SetLocalDescription(offer); err != nil {
+		h.t.Fatal(err)
+	}
+
+	var answer struct {
+		Answer webrtc.SessionDescription `json:"answer"`
+	}
+	h.post("/api/voice/offer", map[string]interface{}{
+		"session_id": c.session.SessionID,
+		"room_id":    c.session.RoomID,
+		"offer":      offer,
+	}, &answer)
+	if err := c.pc.SetRemoteDescription(answer.Answer); err != nil {
+		h.t.Fatalf("set answer: %v", err)
+	}
+
+	for candidate := range candidates {
+		h.post("/api/voice/ice-candidate", map[string]interface{}{
+			"session_id": c.session.SessionID,
+			"room_id":    c.session.RoomID,
+			"candidate":  candidate,
+		}, nil)
+	}
+
+	c.start()
+	return c
+}
+
+// newCaller starts a voice session and sets up the caller's side of it,
+// ready to negotiate. The caller's ICE candidates arrive on the returned
+// channel once negotiation starts.
+func (h *testHarness) newCaller(start models.PhoneNumberRequest) (*testCaller, <-chan webrtc.ICECandidateInit) {
+	h.t.Helper()
+
+	c := &testCaller{
+		t:           h.t,
+		connected:   make(chan struct{}),
+		transcripts: make(chan models.TranscriptMessage, 32),
+	}
+	h.post("/api/voice/start", start, &c.session)
+
+	settingEngine := webrtc.SettingEngine{}
+	settingEngine.SetIncludeLoopbackCandidate(true)
+	mediaEngine := &webrtc.MediaEngine{}
+	if err := mediaEngine.RegisterDefaultCodecs(); err != nil {
+		h.t.Fatal(err)
+	}
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine), webrtc.WithSettingEngine(settingEngine))
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		h.t.Fatalf("caller peer connection: %v", err)
+	}
+	c.pc = pc
+	h.t.Cleanup(func() { pc.Close() })
+
+	if c.track, err = webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus}, "audio", "caller"); err != nil {
+		h.t.Fatal(err)
+	}
+	if _, err := pc.AddTrack(c.track); err != nil {
+		h.t.Fatal(err)
+	}
+
+	dc, err := pc.CreateDataChannel("transcripts", nil)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var transcript models.TranscriptMessage
+		if err := json.Unmarshal(msg.Data, &transcript); err == nil {
+			c.transcripts <- transcript
+		}
+	})
+
+	var once sync.Once
+	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		if state == webrtc.PeerConnectionStateConnected {
+			once.Do(func() { close(c.connected) })
+		}
+	})
+	pc.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		go c.listen(track)
+	})
+
+	candidates := make(chan webrtc.ICECandidateInit, 16)
+	pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+		if candidate == nil {
+			close(candidates)
+			return
+		}
+		candidates <- candidate.ToJSON()
+	})
+
+	return c, candidates
+}
+
+// start waits for the caller to connect and turns on the microphone.
+func (c *testCaller) start() {
+	c.t.Helper()
+
+	select {
+	case <-c.connected:
+	case <-time.After(10 * time.Second):
+		c.t.Fatal("caller never connected")
+	}
+
+	go c.sendMicrophone()
+}
+
+// sendMicrophone streams 20 ms frames in real time: queued speech when there
+// is some, silence otherwise.
+func (c *testCaller) sendMicrophone() {
+	encoder, _ := fake.NewEncoder(media.OpusSampleRate, 1)
+	frameSize := media.SamplesPerFrame(media.OpusSampleRate)
+	packet := make([]byte, 1500)
+
+	ticker := time.NewTicker(media.FrameDuration)
+	defer ticker.Stop()
+
+	var sequence uint16
+	var timestamp uint32
+	for range ticker.C {
+		frame := make([]int16, frameSize)
+		c.mu.Lock()
+		n := copy(frame, c.mic)
+		c.mic = c.mic[n:]
+		c.mu.Unlock()
+
+		size, _ := encoder.Encode(frame, packet)
+		err := c.track.WriteRTP(&rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    111,
+				SequenceNumber: sequence,
+				Timestamp:      timestamp,
+			},
+			Payload: append([]byte(nil), packet[:size]...),
+		})
+		if err != nil || c.pc.ConnectionState() == webrtc.PeerConnectionStateClosed {
+			return
+		}
+		sequence++
+		timestamp += uint32(frameSize)
+	}
+}
+
+// say queues a tone standing in for caller speech.
+func (c *testCaller) say(duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mic = append(c.mic, fake.Tone(300, 0.3, duration, media.OpusSampleRate)...)
+}
+
+func (c *testCaller) listen(track *webrtc.TrackRemote) {
+	decoder, _ := fake.NewDecoder(media.IngestSampleRate, 1)
+	pcm := make([]int16, media.IngestSampleRate)
+
+	for {
+		packet, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		n, err := decoder.Decode(packet.Payload, pcm)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		c.lastPacket = time.Now()
+		if vad.Level(pcm[:n]) > loudLevel {
+			c.loudFrames++
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *testCaller) heard() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.loudFrames
+}
+
+// waitHeard waits until more than after loud frames have arrived.
+func (c *testCaller) waitHeard(after int, timeout time.Duration) int {
+	c.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if n := c.heard(); n > after {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatalf("no agent audio within %v", timeout)
+	return 0
+}
+
+// waitQuiet waits until the agent has sent nothing for quiet.
+func (c *testCaller) waitQuiet(quiet, timeout time.Duration) {
+	c.t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		last := c.lastPacket
+		c.mu.Unlock()
+
+		if !last.IsZero() && time.Since(last) > quiet {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.t.Fatalf("agent still talking after %v", timeout)
+}
+
+// waitTranscript returns the next transcript from speaker, skipping others.
+func (c *testCaller) waitTranscript(speaker string, timeout time.Duration) models.TranscriptMessage {
+	c.t.Helper()
+	return c.waitMessage("transcript", speaker, timeout)
+}
+
+// waitMessage returns the next data channel message of the given type and
+// speaker, skipping others. Messages other than transcripts have no speaker.
+func (c *testCaller) waitMessage(messageType, speaker string, timeout time.Duration) models.TranscriptMessage {
+	c.t.Helper()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-c.transcripts:
+			if msg.Type == messageType && msg.Speaker == speaker {
+				return msg
+			}
+		case <-deadline:
+			c.t.Fatalf("no %s %s message within %v", speaker, messageType, timeout)
+		}
+	}
+}
+
+func TestVoiceCallRoundTrip(t *testing.T) {
+	h := newTestHarness(t,
+		[]string{"What does my policy cover?"},
+		[]string{"Your policy covers hospitalization. Anything else?"})
+
+	caller := h.call("9876543210")
+
+	// The greeting is spoken as soon as the caller connects.
+	greeting := caller.waitHeard(0, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+	if texts := h.synthesizer.Texts(); len(texts) == 0 || texts[0] != agent.Languages["en"].Greeting {
+		t.Fatalf("greeting not synthesized: %q", texts)
+	}
+
+	caller.say(800 * time.Millisecond)
+
+	if got := caller.waitTranscript("user", 5*time.Second); got.Text != "What does my policy cover?" {
+		t.Errorf("user transcript = %q", got.Text)
+	}
+	for _, want := range []string{"Your policy covers hospitalization.", "Anything else?"} {
+		if got := caller.waitTranscript("agent", 5*time.Second); got.Text != want {
+			t.Errorf("agent transcript = %q, want %q", got.Text, want)
+		}
+	}
+
+	caller.waitHeard(greeting, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+
+	// The utterance reached STT as WAV holding at least the spoken tone.
+	audio := h.transcriber.Audio()
+	if len(audio) != 1 {
+		t.Fatalf("transcribed %d utterances, want 1", len(audio))
+	}
+	if least := 44 + media.IngestSampleRate*2*700/1000; len(audio[0]) < least || string(audio[0][:4]) != "RIFF" {
+		t.Errorf("utterance is %d bytes, want a WAV of at least %d", len(audio[0]), least)
+	}
+
+	requests := h.chatModel.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("chat model called %d times, want 1", len(requests))
+	}
+	history := requests[0]
+	if last := history[len(history)-1]; last.Role != "user" || last.Content != "What does my policy cover?" {
+		t.Errorf("last message sent to model = %+v", last)
+	}
+	if first := history[0]; first.Role != "assistant" || !strings.HasPrefix(first.Content, "Hi!") {
+		t.Errorf("greeting missing from history: %+v", first)
+	}
+}
+
+func TestVoiceCallRecording(t *testing.T) {
+	h := newTestHarness(t, []string{"What does my policy cover?"}, []string{"Your policy covers hospitalization."})
+	h.server.config.RecordingDir = t.TempDir()
+	h.server.config.RecordingMix = true
+
+	caller := h.call("9876543210")
+	caller.waitHeard(0, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+	caller.say(600 * time.Millisecond)
+	caller.waitTranscript("agent", 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+
+	// The recording is finished when the caller hangs up.
+	caller.pc.Close()
+	path := filepath.Join(h.server.config.RecordingDir, caller.session.RoomID, recording.ManifestFile)
+	var data []byte
+	deadline := time.Now().Add(10 * time.Second)
+	for data == nil && time.Now().Before(deadline) {
+		data, _ = os.ReadFile(path)
+		time.Sleep(50 * time.Millisecond)
+	}
+	var manifest recording.Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("manifest %s: %v", path, err)
+	}
+
+	if manifest.RoomID != caller.session.RoomID || len(manifest.Tracks) != 2 || manifest.Mix != recording.MixFile {
+		t.Fatalf("manifest = %s", data)
+	}
+	user, agentTrack := manifest.Tracks[0], manifest.Tracks[1]
+	if user.ParticipantID != caller.session.SessionID || user.Speaker != recording.User {
+		t.Errorf("user track = %+v", user)
+	}
+	if agentTrack.Speaker != recording.Agent || agentTrack.Packets == 0 {
+		t.Errorf("agent track = %+v", agentTrack)
+	}
+	// The caller's microphone ran from the start of the call.
+	if user.DurationMs < 1000 || user.Packets < 50 {
+		t.Errorf("user track = %+v", user)
+	}
+	for _, file := range []string{user.File, agentTrack.File, manifest.Mix} {
+		if info, err := os.Stat(filepath.Join(h.server.config.RecordingDir, caller.session.RoomID, file)); err != nil || info.Size() == 0 {
+			t.Errorf("recording file %q missing: %v", file, err)
+		}
+	}
+}
+
+func TestVoiceCallTranscript(t *testing.T) {
+	h := newTestHarness(t, []string{"What does my policy cover?"}, []string{
+		"Your policy covers hospitalization.",
+		// The second request is for the summary once the call ends.
+		`{"caller_intent": "Check what the policy covers", "questions_answered": ["What does my policy cover?"], "unresolved_items": [], "follow_up_needed": false, "disposition": "resolved"}`,
+	})
+	store, err := transcripts.NewJSONL(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.server.transcriptStore = store
+	h.server.config.CallSummaries = true
+
+	caller := h.call("9876543210")
+	caller.waitHeard(0, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+	caller.say(600 * time.Millisecond)
+	caller.waitTranscript("agent", 5*time.Second)
+
+	// The transcript is kept after the call ends.
+	caller.pc.Close()
+	deadline := time.Now().Add(10 * time.Second)
+	for h.server.agentForRoom(caller.session.RoomID) != nil && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	resp, err := http.Get(h.http.URL + "/api/voice/rooms/" + caller.session.RoomID + "/transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET transcript: %s", resp.Status)
+	}
+	var transcript models.TranscriptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&transcript); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ speaker, text string }{
+		{"agent", agent.Languages["en"].Greeting},
+		{"user", "What does my policy cover?"},
+		{"agent", "Your policy covers hospitalization."},
+	}
+	if len(transcript.Messages) != len(want) {
+		t.Fatalf("transcript = %+v", transcript.Messages)
+	}
+	for i, msg := range transcript.Messages {
+		if msg.Speaker != want[i].speaker || msg.Text != want[i].text {
+			t.Errorf("message %d = %s: %q, want %s: %q", i, msg.Speaker, msg.Text, want[i].speaker, want[i].text)
+		}
+		if msg.RoomID != caller.session.RoomID || msg.SessionID != caller.session.SessionID || msg.Timestamp.IsZero() {
+			t.Errorf("message %d = %+v", i, msg)
+		}
+	}
+
+	resp, err = http.Get(h.http.URL + "/api/voice/rooms/no-such-room/transcript")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown room: %s", resp.Status)
+	}
+
+	// The summary follows once the chat model has written it.
+	var summary models.CallSummary
+	deadline = time.Now().Add(5 * time.Second)
+	for summary.RoomID == "" && time.Now().Before(deadline) {
+		resp, err := http.Get(h.http.URL + "/api/voice/rooms/" + caller.session.RoomID + "/summary")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode == http.StatusOK {
+			json.NewDecoder(resp.Body).Decode(&summary)
+		}
+		resp.Body.Close()
+		time.Sleep(50 * time.Millisecond)
+	}
+	if summary.RoomID != caller.session.RoomID || summary.SessionID != caller.session.SessionID ||
+		summary.Disposition != "resolved" || summary.CallerIntent != "Check what the policy covers" {
+		t.Fatalf("summary = %+v", summary)
+	}
+	requests := h.chatModel.Requests()
+	if len(requests) != 2 || !strings.Contains(requests[1][0].Content, "Caller: What does my policy cover?") {
+		t.Errorf("summary request = %+v", requests)
+	}
+}
+
+func TestVoiceCallBargeIn(t *testing.T) {
+	h := newTestHarness(t, []string{"Stop, I have a question."}, []string{"Sure, go ahead."})
+	// Slow the greeting down so there is time to talk over it.
+	h.synthesizer.PerCharacter = 50 * time.Millisecond
+
+	caller := h.call("9876543210")
+	caller.waitHeard(0, 5*time.Second)
+	time.Sleep(500 * time.Millisecond)
+
+	caller.say(600 * time.Millisecond)
+	if got := caller.waitTranscript("user", 5*time.Second); got.Text != "Stop, I have a question." {
+		t.Errorf("user transcript = %q", got.Text)
+	}
+	if got := caller.waitTranscript("agent", 5*time.Second); got.Text != "Sure, go ahead." {
+		t.Errorf("agent transcript = %q", got.Text)
+	}
+
+	requests := h.chatModel.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("chat model called %d times, want 1", len(requests))
+	}
+
+	// Only the part of the greeting played before the interruption is kept.
+	greeting := requests[0][0]
+	if greeting.Role != "assistant" || !strings.HasSuffix(greeting.Content, "...") {
+		t.Errorf("interrupted greeting recorded as %+v", greeting)
+	}
+}
+
+func TestVoiceCallClarification(t *testing.T) {
+	h := newTestHarness(t,
+		[]string{"Thank you.", "you", "Thank you.", "What does my policy cover?"},
+		[]string{"It covers hospitalization."})
+	h.server.config.AgentMaxClarifications = 2
+
+	caller := h.call("9876543210")
+	caller.waitHeard(0, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+
+	// Noise transcripts get a different request to repeat each time, and
+	// the third in a row escalates.
+	english := agent.Languages["en"]
+	for i, want := range []string{english.Clarifications[0], english.Clarifications[1], english.Escalation} {
+		caller.say(600 * time.Millisecond)
+		if i == 2 {
+			caller.waitMessage("escalation", "", 5*time.Second)
+		}
+		if got := caller.waitTranscript("agent", 5*time.Second); got.Text != want {
+			t.Errorf("reply %d = %q, want %q", i, got.Text, want)
+		}
+		caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+	}
+
+	caller.say(600 * time.Millisecond)
+	if got := caller.waitTranscript("agent", 5*time.Second); got.Text != "It covers hospitalization." {
+		t.Errorf("agent transcript = %q", got.Text)
+	}
+
+	requests := h.chatModel.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("chat model called %d times, want 1", len(requests))
+	}
+	for _, msg := range requests[0] {
+		if msg.Role == "user" && msg.Content != "What does my policy cover?" {
+			t.Errorf("unclear utterance reached the model: %q", msg.Content)
+		}
+	}
+}
+
+func TestVoiceCallLanguageSwitch(t *testing.T) {
+	h := newTestHarness(t,
+		[]string{"मेरी पॉलिसी कब खत्म होगी?", "And what is my sum insured?"},
+		[]string{"आपकी पॉलिसी 3 मई को खत्म होगी। और कुछ?", "Your sum insured is five lakh rupees."})
+	// The Hindi question is recognized by its script; the English one by the
+	// language the transcriber reports.
+	h.transcriber.SetLanguages("", "english")
+
+	caller := h.callWith(models.PhoneNumberRequest{PhoneNumber: "9876543210", Language: "auto"})
+	caller.waitHeard(0, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+
+	// A Hindi question gets a Hindi answer, split on the danda and spoken
+	// with the multilingual model.
+	caller.say(600 * time.Millisecond)
+	for _, want := range []string{"आपकी पॉलिसी 3 मई को खत्म होगी।", "और कुछ?"} {
+		if got := caller.waitTranscript("agent", 5*time.Second); got.Text != want {
+			t.Errorf("agent transcript = %q, want %q", got.Text, want)
+		}
+	}
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+
+	// Switching back to English switches the reply language back too.
+	caller.say(600 * time.Millisecond)
+	caller.waitTranscript("agent", 5*time.Second)
+
+	if options := h.transcriber.Options(); len(options) != 2 || options[0].Language != "" {
+		t.Errorf("auto mode sent a language hint: %+v", options)
+	}
+
+	prompts := h.chatModel.SystemPrompts()
+	if len(prompts) != 2 || !strings.Contains(prompts[0], "Hindi") || strings.Contains(prompts[1], "Hindi") {
+		t.Errorf("system prompts did not follow the caller's language: %q", prompts)
+	}
+
+	texts, voices := h.synthesizer.Texts(), h.synthesizer.Options()
+	models := make(map[string]string)
+	for i, text := range texts {
+		models[text] = voices[i].ModelID
+	}
+	if models[agent.Languages["en"].Greeting] != h.server.config.TTSModelID {
+		t.Errorf("greeting model = %q", models[agent.Languages["en"].Greeting])
+	}
+	if got := models["और कुछ?"]; got != h.server.config.TTSHindiModelID {
+		t.Errorf("Hindi reply model = %q, want %q", got, h.server.config.TTSHindiModelID)
+	}
+	if got := models["Your sum insured is five lakh rupees."]; got != h.server.config.TTSModelID {
+		t.Errorf("English reply model = %q", got)
+	}
+}
+
+func TestVoiceCallHindiGreeting(t *testing.T) {
+	h := newTestHarness(t, nil, nil)
+
+	caller := h.callWith(models.PhoneNumberRequest{PhoneNumber: "9876543210", Language: "hi"})
+	caller.waitHeard(0, 5*time.Second)
+	if texts := h.synthesizer.Texts(); len(texts) == 0 || texts[0] != agent.Languages["hi"].Greeting {
+		t.Errorf("greeting = %q", texts)
+	}
+
+	body, _ := json.Marshal(models.PhoneNumberRequest{PhoneNumber: "9876543210", Language: "fr"})
+	resp, err := http.Post(h.http.URL+"/api/voice/start", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unsupported language: status %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestVoiceCallSessionVoice(t *testing.T) {
+	h := newTestHarness(t, nil, nil)
+	h.synthesizer.Voices = []string{"1qEiC6qsybMkmnNdVMbK", "hindi-voice"}
+
+	speed := 1.1
+	caller := h.callWith(models.PhoneNumberRequest{
+		PhoneNumber: "9876543210",
+		Voice:       &models.VoiceRequest{VoiceID: "hindi-voice", OutputFormat: "pcm_16000", Speed: speed},
+	})
+	caller.waitHeard(0, 5*time.Second)
+
+	got := h.synthesizer.Options()[0]
+	if got.VoiceID != "hindi-voice" || got.OutputFormat != "pcm_16000" || got.Speed != speed {
+		t.Errorf("greeting voice = %+v", got)
+	}
+	// Fields the session left alone come from config.
+	if got.ModelID != h.server.config.TTSModelID || got.Settings == nil || *got.Settings.Stability != h.server.config.TTSStability {
+		t.Errorf("greeting voice lost configured defaults: %+v", got)
+	}
+
+	start := func(req models.PhoneNumberRequest) int {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		resp, err := http.Post(h.http.URL+"/api/voice/start", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := start(models.PhoneNumberRequest{PhoneNumber: "9876543210", Voice: &models.VoiceRequest{VoiceID: "no-such-voice"}}); status != http.StatusBadRequest {
+		t.Errorf("unknown voice: status %d, want 400", status)
+	}
+
+	// Configured voices are checked even when the session keeps them.
+	h.server.config.TTSHindiVoiceID = "retired-voice"
+	if status := start(models.PhoneNumberRequest{PhoneNumber: "9876543210"}); status != http.StatusInternalServerError {
+		t.Errorf("unknown Hindi voice: status %d, want 500", status)
+	}
+	h.server.config.TTSHindiVoiceID = "hindi-voice"
+	h.server.config.TTSVoiceID = "retired-voice"
+	if status := start(models.PhoneNumberRequest{PhoneNumber: "9876543210"}); status != http.StatusInternalServerError {
+		t.Errorf("unknown agent voice: status %d, want 500", status)
+	}
+	// A session voice replaces the configured ones.
+	if status := start(models.PhoneNumberRequest{PhoneNumber: "9876543210", Voice: &models.VoiceRequest{VoiceID: "hindi-voice"}}); status != http.StatusOK {
+		t.Errorf("session voice over unknown configured ones: status %d, want 200", status)
+	}
+}
+
+func TestVoiceCallStreamingTTS(t *testing.T) {
+	h := newTestHarness(t,
+		[]string{"Is my policy active?"},
+		[]string{"Yes, it is active. Anything else?"})
+
+	elevenLabs := fake.NewElevenLabsServer()
+	defer elevenLabs.Close()
+	h.server.synthesizer = tts.NewElevenLabsStream("test-key", elevenLabs.URL())
+
+	caller := h.call("9876543210")
+	greeting := caller.waitHeard(0, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+
+	caller.say(800 * time.Millisecond)
+	if got := caller.waitTranscript("user", 5*time.Second); got.Text != "Is my policy active?" {
+		t.Errorf("user transcript = %q", got.Text)
+	}
+	for _, want := range []string{"Yes, it is active.", "Anything else?"} {
+		if got := caller.waitTranscript("agent", 5*time.Second); got.Text != want {
+			t.Errorf("agent transcript = %q, want %q", got.Text, want)
+		}
+	}
+	caller.waitHeard(greeting, 5*time.Second)
+	caller.waitQuiet(200*time.Millisecond, 5*time.Second)
+
+	// One socket for the greeting and one for the whole reply.
+	if paths := elevenLabs.Paths(); len(paths) != 2 {
+		t.Errorf("opened %d sockets, want 2", len(paths))
+	}
+	history := h.chatModel.Requests()[0]
+	if greeting := history[0]; greeting.Role != "assistant" || !strings.HasPrefix(greeting.Content, "Hi!") {
+		t.Errorf("greeting missing from history: %+v", greeting)
+	}
+}
+
+// testSignaling is a client of the signaling WebSocket. Agent states and
+// the server's ICE candidates are collected apart from the other messages.
+type testSignaling struct {
+	t          *testing.T
+	conn       *websocket.Conn
+	msgs       chan models.SignalMessage
+	states     chan string
+	candidates chan webrtc.ICECandidateInit
+}
+
+func (h *testHarness) signalingURL(roomID, clientID string) string {
+	return "ws" + strings.TrimPrefix(h.http.URL, "http") + "/api/voice/ws?room_id=" + roomID + "&client_id=" + clientID
+}
+
+func (h *testHarness) dialSignaling(roomID, clientID string) *testSignaling {
+	h.t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial(h.signalingURL(roomID, clientID), nil)
+	if err != nil {
+		h.t.Fatalf("dial signaling: %v", err)
+	}
+	h.t.Cleanup(func() { conn.Close() })
+
+	s := &testSignaling{
+		t:          h.t,
+		conn:       conn,
+		msgs:       make(chan models.SignalMessage, 32),
+		states:     make(chan string, 64),
+		candidates: make(chan webrtc.ICECandidateInit, 32),
+	}
+	go func() {
+		for {
+			var msg models.SignalMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			if msg.Type == signaling.TypeAgentState {
+				data, _ := msg.Data.(map[string]interface{})
+				state, _ := data["state"].(string)
+				s.states <- state
+				continue
+			}
+			if msg.Type == signaling.TypeCandidate && msg.Candidate != nil {
+				s.candidates <- *msg.Candidate
+				continue
+			}
+			s.msgs <- msg
+		}
+	}()
+	return s
+}
+
+func (s *testSignaling) send(msg models.SignalMessage) {
+	s.t.Helper()
+	if err := s.conn.WriteJSON(msg); err != nil {
+		s.t.Fatalf("send %s: %v", msg.Type, err)
+	}
+}
+
+func (s *testSignaling) next(timeout time.Duration) models.SignalMessage {
+	s.t.Helper()
+	select {
+	case msg := <-s.msgs:
+		return msg
+	case <-time.After(timeout):
+		s.t.Fatal("no signaling message")
+		return models.SignalMessage{}
+	}
+}
+
+func (s *testSignaling) expect(msgType string) models.SignalMessage {
+	s.t.Helper()
+	msg := s.next(10 * time.Second)
+	if msg.Type != msgType {
+		s.t.Fatalf("got %s message (%s), want %s", msg.Type, msg.Error, msgType)
+	}
+	return msg
+}
+
+// addTrickled adds the server's trickled candidates to pc until the empty
+// one that ends them. It fails unless there are some and all were gathered
+// for desc, the server description they follow.
+func (s *testSignaling) addTrickled(pc *webrtc.PeerConnection, desc *webrtc.SessionDescription, after string) {
+	s.t.Helper()
+	for trickled := 0; ; trickled++ {
+		var candidate webrtc.ICECandidateInit
+		select {
+		case candidate = <-s.candidates:
+		case <-time.After(5 * time.Second):
+			s.t.Fatalf("server trickled %d candidates after its %s and never finished", trickled, after)
+		}
+		if candidate.Candidate == "" {
+			if trickled == 0 {
+				s.t.Fatalf("server trickled no candidates after its %s", after)
+			}
+			return
+		}
+		if !strings.HasSuffix(candidate.Candidate, " ufrag "+ufrag(desc.SDP)) {
+			s.t.Fatalf("server trickled %q after its %s, gathered for other credentials", candidate.Candidate, after)
+		}
+		if err := pc.AddICECandidate(candidate); err != nil {
+			s.t.Fatalf("add server candidate: %v", err)
+		}
+	}
+}
+
+// waitStates waits for the agent to move through want, in order.
+func (s *testSignaling) waitStates(want ...string) {
+	s.t.Helper()
+	for _, state := range want {
+		select {
+		case got := <-s.states:
+			if got != state {
+				s.t.Fatalf("agent state %q, want %q", got, state)
+			}
+		case <-time.After(5 * time.Second):
+			s.t.Fatalf("agent never %s", state)
+		}
+	}
+}
+
+func TestVoiceCallWebSocketSignaling(t *testing.T) {
+	h := newTestHarness(t,
+		[]string{"What does my policy cover?"},
+		[]string{"Your policy covers hospitalization."})
+
+	caller, candidates := h.newCaller(models.PhoneNumberRequest{PhoneNumber: "9876543210"})
+	sig := h.dialSignaling(caller.session.RoomID, caller.session.SessionID)
+
+	// The client stays in the room it connected to.
+	sig.send(models.SignalMessage{Type: signaling.TypeJoin, RoomID: "another-room"})
+	if msg := sig.expect(signaling.TypeError); !strings.Contains(msg.Error, caller.session.RoomID) {
+		t.Errorf("error joining another room = %q", msg.Error)
+	}
+	sig.send(models.SignalMessage{Type: signaling.TypeJoin, RoomID: caller.session.RoomID})
+	if msg := sig.expect(signaling.TypeJoined); msg.RoomID != caller.session.RoomID {
+		t.Errorf("joined room %q", msg.RoomID)
+	} else if data, _ := msg.Data.(map[string]interface{}); data["ice_trickle"] != true {
+		t.Errorf("joined data = %v", msg.Data)
+	}
+	sig.send(models.SignalMessage{Type: "dance"})
+	sig.expect(signaling.TypeError)
+
+	offer, err := caller.pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := caller.pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	sig.send(models.SignalMessage{Type: signaling.TypeOffer, SDP: &offer})
+	answer := sig.expect(signaling.TypeAnswer)
+	if err := caller.pc.SetRemoteDescription(*answer.SDP); err != nil {
+		t.Fatalf("set answer: %v", err)
+	}
+	for candidate := range candidates {
+		sig.send(models.SignalMessage{Type: signaling.TypeCandidate, Candidate: &candidate})
+	}
+
+	// The server's candidates trickle in after its answer.
+	sig.addTrickled(caller.pc, answer.SDP, "answer")
+	caller.start()
+
+	// The greeting is spoken once the caller connects.
+	caller.waitHeard(0, 5*time.Second)
+	sig.waitStates(agent.StateSpeaking, agent.StateListening)
+
+	caller.say(800 * time.Millisecond)
+	sig.waitStates(agent.StateThinking, agent.StateSpeaking, agent.StateListening)
+	if got := caller.waitTranscript("agent", 5*time.Second); got.Text != "Your policy covers hospitalization." {
+		t.Errorf("agent transcript = %q", got.Text)
+	}
+
+	// A client that joins late learns what the agent is doing.
+	sig.send(models.SignalMessage{Type: signaling.TypeJoin})
+	if data, _ := sig.expect(signaling.TypeJoined).Data.(map[string]interface{}); data["agent_state"] != agent.StateListening {
+		t.Errorf("joined mid-call with data %v", data)
+	}
+
+	room, _ := h.server.roomManager.GetRoom(caller.session.RoomID)
+	user, _ := room.GetParticipant(caller.session.SessionID)
+	waitReconnected := func(what string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); user.PeerConnection.SignalingState() != webrtc.SignalingStateStable; {
+			if time.Now().After(deadline) {
+				t.Fatalf("server signaling state %s after %s", user.PeerConnection.SignalingState(), what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		for deadline := time.Now().Add(5 * time.Second); user.PeerConnection.ICEConnectionState() != webrtc.ICEConnectionStateConnected; {
+			if time.Now().After(deadline) {
+				t.Fatalf("server ICE state %s after %s", user.PeerConnection.ICEConnectionState(), what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	// restartGathering collects the caller's candidates once its gathering
+	// restarts; they are sent after the answer, which the server needs first.
+	restartGathering := func() <-chan webrtc.ICECandidateInit {
+		gathered := make(chan webrtc.ICECandidateInit, 16)
+		caller.pc.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+			if candidate == nil {
+				close(gathered)
+				return
+			}
+			gathered <- candidate.ToJSON()
+		})
+		return gathered
+	}
+
+	// The server restarts ICE with an offer of its own and trickles its new
+	// candidates after it.
+	if err := h.server.signalingServer.RestartICE(caller.session.SessionID); err != nil {
+		t.Fatalf("RestartICE: %v", err)
+	}
+	restart := sig.expect(signaling.TypeOffer)
+	if ufrag(restart.SDP.SDP) == ufrag(answer.SDP.SDP) {
+		t.Error("ICE restart offer kept the old credentials")
+	}
+	gathered := restartGathering()
+	if err := caller.pc.SetRemoteDescription(*restart.SDP); err != nil {
+		t.Fatalf("set server offer: %v", err)
+	}
+	sig.addTrickled(caller.pc, restart.SDP, "ICE restart offer")
+	reply, err := caller.pc.CreateAnswer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := caller.pc.SetLocalDescription(reply); err != nil {
+		t.Fatal(err)
+	}
+	sig.send(models.SignalMessage{Type: signaling.TypeAnswer, SDP: &reply})
+	for candidate := range gathered {
+		sig.send(models.SignalMessage{Type: signaling.TypeCandidate, Candidate: &candidate})
+	}
+	waitReconnected("server ICE restart")
+
+	// The caller restarts ICE in turn, and the server's answer to it is
+	// followed by the candidates it gathered afresh.
+	gathered = restartGathering()
+	offer, err = caller.pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := caller.pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	sig.send(models.SignalMessage{Type: signaling.TypeOffer, SDP: &offer})
+	restartAnswer := sig.expect(signaling.TypeAnswer)
+	if ufrag(restartAnswer.SDP.SDP) == ufrag(restart.SDP.SDP) {
+		t.Error("answer to the caller's ICE restart kept the old credentials")
+	}
+	if err := caller.pc.SetRemoteDescription(*restartAnswer.SDP); err != nil {
+		t.Fatalf("set restart answer: %v", err)
+	}
+	for candidate := range gathered {
+		sig.send(models.SignalMessage{Type: signaling.TypeCandidate, Candidate: &candidate})
+	}
+	sig.addTrickled(caller.pc, restartAnswer.SDP, "answer to the caller's ICE restart")
+	waitReconnected("caller ICE restart")
+
+	// Leaving ends the call, and the server hangs up.
+	sig.send(models.SignalMessage{Type: signaling.TypeLeave})
+	hangup := sig.expect(signaling.TypeHangup)
+	if data, _ := hangup.Data.(map[string]interface{}); data["reason"] != "call_ended" {
+		t.Errorf("hangup data = %v", hangup.Data)
+	}
+}
+
+// ufrag returns the ICE username fragment of an SDP.
+func ufrag(sdp string) string {
+	_, rest, _ := strings.Cut(sdp, "a=ice-ufrag:")
+	value, _, _ := strings.Cut(rest, "\r\n")
+	return value
+}
+
+func TestSignalingRoomMembership(t *testing.T) {
+	h := newTestHarness(t, nil, nil)
+
+	first, _ := h.newCaller(models.PhoneNumberRequest{PhoneNumber: "9876543210"})
+	second, _ := h.newCaller(models.PhoneNumberRequest{PhoneNumber: "9123456780"})
+
+	// Sockets only connect to a room their session is a caller in.
+	room, _ := h.server.roomManager.GetRoom(first.session.RoomID)
+	var agentID string
+	for _, p := range room.GetParticipants() {
+		if p.IsAgent {
+			agentID = p.ID
+		}
+	}
+	for _, tc := range []struct {
+		name, roomID, clientID string
+		status                 int
+	}{
+		{"no room", "", first.session.SessionID, http.StatusBadRequest},
+		{"unknown room", "no-such-room", first.session.SessionID, http.StatusNotFound},
+		{"other caller's room", second.session.RoomID, first.session.SessionID, http.StatusForbidden},
+		{"agent", first.session.RoomID, agentID, http.StatusForbidden},
+	} {
+		conn, resp, err := websocket.DefaultDialer.Dial(h.signalingURL(tc.roomID, tc.clientID), nil)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: connected", tc.name)
+			continue
+		}
+		if resp == nil || resp.StatusCode != tc.status {
+			t.Errorf("%s: refused with %v, want %d", tc.name, resp, tc.status)
+		}
+	}
+
+	firstSig := h.dialSignaling(first.session.RoomID, first.session.SessionID)
+	secondSig := h.dialSignaling(second.session.RoomID, second.session.SessionID)
+
+	// Confirming the room also shows each socket is registered.
+	firstSig.send(models.SignalMessage{Type: signaling.TypeJoin})
+	firstSig.expect(signaling.TypeJoined)
+	secondSig.send(models.SignalMessage{Type: signaling.TypeJoin})
+	secondSig.expect(signaling.TypeJoined)
+
+	h.server.signalingServer.BroadcastToRoom(first.session.RoomID, &models.SignalMessage{Type: "notice", RoomID: first.session.RoomID}, "")
+	h.server.signalingServer.BroadcastToRoom(second.session.RoomID, &models.SignalMessage{Type: "excluded"}, second.session.SessionID)
+	if msg := firstSig.expect("notice"); msg.RoomID != first.session.RoomID {
+		t.Errorf("broadcast = %+v", msg)
+	}
+
+	// Neither the other room's broadcast nor the excluded one arrive.
+	secondSig.send(models.SignalMessage{Type: signaling.TypeJoin})
+	secondSig.expect(signaling.TypeJoined)
+}
+
+func TestVoiceCallWithoutCodec(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		noEnc, noDec bool
+	}{
+		{"encoder", true, false},
+		{"decoder", false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTestHarness(t, nil, nil)
+			if tc.noEnc {
+				h.server.newEncoder = func(sampleRate, channels int) (media.Encoder, error) {
+					return nil, media.ErrEncoderUnavailable
+				}
+			}
+			if tc.noDec {
+				h.server.newDecoder = func(sampleRate, channels int) (media.Decoder, error) {
+					return nil, media.ErrDecoderUnavailable
+				}
+			}
+
+			caller, _ := h.newCaller(models.PhoneNumberRequest{PhoneNumber: "9876543210"})
+
+			// A call where the agent cannot be heard, or cannot hear, ends
+			// without waiting for the caller to connect.
+			for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+				if _, exists := h.server.roomManager.GetRoom(caller.session.RoomID); !exists {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatal("call kept running")
+				}
+			}
+		})
+	}
+}
+
+func TestVoiceCallTrickleHTTP(t *testing.T) {
+	h := newTestHarness(t, nil, nil)
+
+	caller, candidates := h.newCaller(models.PhoneNumberRequest{PhoneNumber: "9876543210"})
+	offer, err := caller.pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := caller.pc.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	var answer struct {
+		Answer  webrtc.SessionDescription `json:"answer"`
+		Trickle bool                      `json:"trickle"`
+	}
+	h.post("/api/voice/offer", map[string]interface{}{
+		"session_id": caller.session.SessionID,
+		"room_id":    caller.session.RoomID,
+		"offer":      offer,
+		"trickle":    true,
+	}, &answer)
+	if !answer.Trickle {
+		t.Fatal("trickle answer refused")
+	}
+	if err := caller.pc.SetRemoteDescription(answer.Answer); err != nil {
+		t.Fatalf("set answer: %v", err)
+	}
+	for candidate := range candidates {
+		h.post("/api/voice/ice-candidate", map[string]interface{}{
+			"session_id": caller.session.SessionID,
+			"room_id":    caller.session.RoomID,
+			"candidate":  candidate,
+		}, nil)
+	}
+
+	// Poll the server's candidates until it has gathered them all.
+	trickled := 0
+	for next, done := 0, false; !done; {
+		url := fmt.Sprintf("%s/api/voice/ice-candidates?session_id=%s&room_id=%s&after=%d",
+			h.http.URL, caller.session.SessionID, caller.session.RoomID, next)
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var poll iceCandidatesResponse
+		err = json.NewDecoder(resp.Body).Decode(&poll)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("poll candidates: %s, %v", resp.Status, err)
+		}
+
+		for _, candidate := range poll.Candidates {
+			if err := caller.pc.AddICECandidate(candidate); err != nil {
+				t.Fatalf("add server candidate: %v", err)
+			}
+		}
+		trickled += len(poll.Candidates)
+		next, done = poll.Next, poll.Done
+	}
+	if trickled == 0 {
+		t.Fatal("server trickled no candidates")
+	}
+
+	caller.start()
+	caller.waitHeard(0, 5*time.Second)
+
+	resp, err := http.Get(h.http.URL + "/api/voice/ice-candidates?session_id=nobody&room_id=" + caller.session.RoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("poll for unknown session: %s", resp.Status)
+	}
+}
+
+func TestSTTStream(t *testing.T) {
+	h := newTestHarness(t, []string{"my policy", "my policy number is", "my policy number is 4871", "thanks"}, nil)
+	h.server.config.OpenAIKey = "test-key"
+	h.transcriber.SetPauses(0, 200*time.Millisecond, time.Second, 0)
+
+	caller, _ := h.newCaller(models.PhoneNumberRequest{PhoneNumber: "9876543210"})
+	sessionID, roomID := caller.session.SessionID, caller.session.RoomID
+	streamURL := func(roomID, sessionID string) string {
+		return "ws" + strings.TrimPrefix(h.http.URL, "http") + "/api/voice/stt/stream?session_id=" + sessionID + "&room_id=" + roomID + "&vocabulary=Zinal+Bhogar"
+	}
+
+	// Only the room's caller may stream audio into it.
+	room, _ := h.server.roomManager.GetRoom(roomID)
+	var agentID string
+	for _, p := range room.GetParticipants() {
+		if p.IsAgent {
+			agentID = p.ID
+		}
+	}
+	for _, tc := range []struct {
+		name, roomID, sessionID string
+		status                  int
+	}{
+		{"no session", roomID, "", http.StatusBadRequest},
+		{"unknown room", "no-such-room", sessionID, http.StatusNotFound},
+		{"agent", roomID, agentID, http.StatusForbidden},
+	} {
+		conn, resp, err := websocket.DefaultDialer.Dial(streamURL(tc.roomID, tc.sessionID), nil)
+		if err == nil {
+			conn.Close()
+			t.Errorf("%s: connected", tc.name)
+			continue
+		}
+		if resp == nil || resp.StatusCode != tc.status {
+			t.Errorf("%s: refused with %v, want %d", tc.name, resp, tc.status)
+		}
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(streamURL(roomID, sessionID), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	next := func() models.STTEvent {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var event models.STTEvent
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		if event.SessionID != sessionID || event.RoomID != roomID {
+			t.Errorf("event tagged %q/%q, want %s/%s", event.SessionID, event.RoomID, sessionID, roomID)
+		}
+		return event
+	}
+	send := func(n int) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, n)); err != nil {
+			t.Fatalf("write audio: %v", err)
+		}
+	}
+
+	send(sttPartialBytes)
+	if event := next(); event.Type != "partial" || event.Text != "my policy" {
+		t.Errorf("first event = %+v, want partial", event)
+	}
+
+	// However much is buffered, the utterance goes on until the caller
+	// pauses.
+	send(sttBatchBytes - sttPartialBytes)
+	if event := next(); event.Type != "partial" || event.Text != "my policy number is" {
+		t.Errorf("second event = %+v, want partial", event)
+	}
+	send(sttPartialBytes)
+	if event := next(); event.Type != "final" || event.Text != "my policy number is 4871" {
+		t.Errorf("third event = %+v, want final after a pause", event)
+	}
+
+	// Ending the recording finishes the next utterance, which starts after
+	// the one the pause ended.
+	send(1000)
+	if err := conn.WriteJSON(map[string]string{"type": "end"}); err != nil {
+		t.Fatalf("write end: %v", err)
+	}
+	if event := next(); event.Type != "final" || event.Text != "thanks" {
+		t.Errorf("fourth event = %+v, want final", event)
+	}
+
+	// Terms given for the connection go into the recognizer prompt.
+	if prompt := h.transcriber.Options()[0].Prompt; prompt != "Zinal Bhogar." {
+		t.Errorf("prompt = %q", prompt)
+	}
+
+	audio := h.transcriber.Audio()
+	if len(audio) != 4 || len(audio[2]) != sttBatchBytes+sttPartialBytes || len(audio[3]) != 1000 {
+		t.Errorf("transcribed %d snapshots", len(audio))
+	}
+
+	if err := conn.WriteJSON(map[string]string{"type": "pause"}); err != nil {
+		t.Fatalf("write control: %v", err)
+	}
+	if event := next(); event.Type != "error" {
+		t.Errorf("unknown control answered with %+v", event)
+	}
+}
+
+func TestSTTRequest(t *testing.T) {
+	h := newTestHarness(t,
+		[]string{"What does my policy cover?"},
+		[]string{"Your policy covers hospitalization."})
+	h.server.config.OpenAIKey = "test-key"
+
+	caller := h.call("9876543210")
+	other, _ := h.newCaller(models.PhoneNumberRequest{PhoneNumber: "9123456780"})
+	caller.waitHeard(0, 5*time.Second)
+
+	post := func(roomID, sessionID string, n int) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, h.http.URL+"/api/voice/stt", bytes.NewReader(make([]byte, n)))
+		req.Header.Set("X-Room-ID", roomID)
+		req.Header.Set("X-Session-ID", sessionID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result struct {
+			Text string `json:"text"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp, result.Text
+	}
+
+	// Only the room's caller may send audio.
+	roomID := caller.session.RoomID
+	for _, tc := range []struct {
+		name, sessionID string
+		status          int
+	}{
+		{"no session", "", http.StatusBadRequest},
+		{"another room's caller", other.session.SessionID, http.StatusForbidden},
+	} {
+		if resp, _ := post(roomID, tc.sessionID, sttBatchBytes); resp.StatusCode != tc.status {
+			t.Errorf("%s: %s, want %d", tc.name, resp.Status, tc.status)
+		}
+	}
+	if len(h.transcriber.Audio()) != 0 {
+		t.Fatal("refused audio was transcribed")
+	}
+
+	// The transcript goes back to the client; a cut made at a byte count is
+	// not a finished turn, so the agent does not answer it.
+	resp, text := post(roomID, caller.session.SessionID, sttBatchBytes)
+	if resp.StatusCode != http.StatusOK || text != "What does my policy cover?" {
+		t.Fatalf("caller's audio: %s, text %q", resp.Status, text)
+	}
+	if got := h.chatModel.Requests(); len(got) != 0 {
+		t.Errorf("agent answered a batch cut: %d chat requests", len(got))
+	}
+}
@@ -0,0 +1,155 @@
+package media
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	opusPayloadType = 111
+
+	// maxOpusPacket is the largest Opus packet RFC 6716 allows.
+	maxOpusPacket = 1275
+)
+
+// RTPWriter is the outbound side of a track, such as
+// webrtc.TrackLocalStaticRTP.
+type RTPWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+}
+
+type multiRTPWriter []RTPWriter
+
+// MultiRTPWriter returns a writer that passes each packet to every writer in
+// turn, like io.MultiWriter, stopping at the first error.
+func MultiRTPWriter(writers ...RTPWriter) RTPWriter {
+	return multiRTPWriter(writers)
+}
+
+func (m multiRTPWriter) WriteRTP(packet *rtp.Packet) error {
+	for _, w := range m {
+		if err := w.WriteRTP(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Egress plays PCM to a participant as Opus RTP. Audio is resampled to
+// 48 kHz, cut into 20 ms frames and written in real time; the RTP timestamp
+// keeps advancing across the silence between utterances.
+type Egress struct {
+	mu        sync.Mutex
+	track     RTPWriter
+	encoder   Encoder
+	sequence  uint16
+	timestamp uint32
+	lastSent  time.Time
+}
+
+func NewEgress(track RTPWriter, encoder Encoder) *Egress {
+	return &Egress{
+		track:   track,
+		encoder: encoder,
+	}
+}
+
+// Speak reads mono 16-bit little-endian PCM at sampleRate from pcm and plays
+// it. It returns when pcm is exhausted or, within one frame, once ctx is
+// done, and reports how much audio was sent.
+func (e *Egress) Speak(ctx context.Context, pcm io.Reader, sampleRate int) (time.Duration, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	inFrame := SamplesPerFrame(sampleRate)
+	outFrame := SamplesPerFrame(OpusSampleRate)
+	raw := make([]byte, inFrame*2)
+	samples := make([]int16, inFrame)
+	packet := make([]byte, maxOpusPacket)
+
+	if !e.lastSent.IsZero() {
+		if idle := time.Since(e.lastSent) - FrameDuration; idle > 0 {
+			e.timestamp += uint32(idle.Seconds() * OpusSampleRate)
+		}
+	}
+
+	marker := true
+	next := time.Now()
+	var played time.Duration
+
+	for {
+		n, err := io.ReadFull(pcm, raw)
+		if errors.Is(err, io.EOF) {
+			return played, nil
+		}
+		lastFrame := errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !lastFrame {
+			return played, err
+		}
+
+		// Pad the final partial frame with silence.
+		clear(raw[n:])
+		for i := range samples {
+			samples[i] = int16(binary.LittleEndian.Uint16(raw[i*2:]))
+		}
+
+		frame := fitFrame(Resample(samples, sampleRate, OpusSampleRate), outFrame)
+		size, err := e.encoder.Encode(frame, packet)
+		if err != nil {
+			return played, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return played, ctx.Err()
+		case <-time.After(time.Until(next)):
+		}
+
+		if err := e.writeFrame(packet[:size], marker); err != nil {
+			return played, err
+		}
+		marker = false
+		next = next.Add(FrameDuration)
+		played += FrameDuration
+
+		if lastFrame {
+			return played, nil
+		}
+	}
+}
+
+func (e *Egress) writeFrame(payload []byte, marker bool) error {
+	p := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			Marker:         marker,
+			PayloadType:    opusPayloadType,
+			SequenceNumber: e.sequence,
+			Timestamp:      e.timestamp,
+		},
+		Payload: append([]byte(nil), payload...),
+	}
+
+	e.sequence++
+	e.timestamp += uint32(SamplesPerFrame(OpusSampleRate))
+	e.lastSent = time.Now()
+
+	return e.track.WriteRTP(p)
+}
+
+// fitFrame pads or trims pcm to exactly n samples, absorbing rounding from
+// resampling rates that do not divide 48 kHz.
+func fitFrame(pcm []int16, n int) []int16 {
+	if len(pcm) >= n {
+		return pcm[:n]
+	}
+	out := make([]int16, n)
+	copy(out, pcm)
+	return out
+}
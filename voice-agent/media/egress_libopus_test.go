@@ -0,0 +1,86 @@
+//go:build libopus
+
+package media_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"voice-agent/media"
+
+	"github.com/pion/rtp"
+)
+
+type rtpCollector struct {
+	packets []*rtp.Packet
+}
+
+func (c *rtpCollector) WriteRTP(packet *rtp.Packet) error {
+	c.packets = append(c.packets, packet)
+	return nil
+}
+
+// tonePCM is duration of a 440 Hz tone as 16-bit little-endian PCM.
+func tonePCM(sampleRate int, duration time.Duration) []byte {
+	n := int(duration.Seconds() * float64(sampleRate))
+	pcm := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		v := int16(8000 * math.Sin(2*math.Pi*440*float64(i)/float64(sampleRate)))
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(v))
+	}
+	return pcm
+}
+
+func TestEgressLibopus(t *testing.T) {
+	encoder, err := media.NewEncoder(media.OpusSampleRate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	track := &rtpCollector{}
+	egress := media.NewEgress(track, encoder)
+
+	played, err := egress.Speak(context.Background(), bytes.NewReader(tonePCM(16000, 200*time.Millisecond)), 16000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if played != 200*time.Millisecond || len(track.packets) != 10 {
+		t.Fatalf("played %v in %d packets, want 200ms in 10", played, len(track.packets))
+	}
+
+	decoder, err := media.NewDecoder(16000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := make([]int16, media.SamplesPerFrame(16000))
+	for i, p := range track.packets {
+		if p.PayloadType != 111 || p.Marker != (i == 0) {
+			t.Errorf("packet %d: payload type %d, marker %v", i, p.PayloadType, p.Marker)
+		}
+		if i > 0 {
+			prev := track.packets[i-1]
+			if p.SequenceNumber != prev.SequenceNumber+1 || p.Timestamp-prev.Timestamp != 960 {
+				t.Errorf("packet %d: sequence %d, timestamp %d after %d, %d", i, p.SequenceNumber, p.Timestamp, prev.SequenceNumber, prev.Timestamp)
+			}
+		}
+
+		n, err := decoder.Decode(p.Payload, pcm)
+		if err != nil || n != len(pcm) {
+			t.Fatalf("decode packet %d: %d samples, %v", i, n, err)
+		}
+		// The encoder needs a few frames to settle; after that the tone
+		// comes back at about the level it was sent.
+		if i >= 3 {
+			var sum float64
+			for _, s := range pcm[:n] {
+				sum += float64(s) * float64(s)
+			}
+			if rms := math.Sqrt(sum / float64(n)); rms < 2000 {
+				t.Errorf("packet %d decodes to rms %.0f, want the tone back", i, rms)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package media
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+const (
+	// IngestSampleRate is the PCM rate handed to speech recognition.
+	IngestSampleRate = 16000
+
+	ingestJitterDepth = 5
+	ingestFrameQueue  = 100
+)
+
+// Ingest turns a caller's Opus RTP stream into 16 kHz mono PCM. Packets go
+// through a jitter buffer, are depacketized and decoded, and each decoded
+// frame is published on Frames. Lost packets are concealed so the frame
+// stream keeps real time.
+type Ingest struct {
+	mu           sync.Mutex
+	jitter       *JitterBuffer
+	depacketizer codecs.OpusPacket
+	decoder      Decoder
+	pcm          []int16
+	frames       chan []int16
+	closed       bool
+}
+
+// NewIngest creates an ingest that decodes with decoder, which must produce
+// mono PCM at IngestSampleRate.
+func NewIngest(decoder Decoder) *Ingest {
+	return &Ingest{
+		jitter:  NewJitterBuffer(ingestJitterDepth),
+		decoder: decoder,
+		// Opus packets carry at most 120 ms of audio.
+		pcm:    make([]int16, IngestSampleRate*120/1000),
+		frames: make(chan []int16, ingestFrameQueue),
+	}
+}
+
+// Frames delivers decoded PCM frames. It is closed by Close.
+func (i *Ingest) Frames() <-chan []int16 {
+	return i.frames
+}
+
+// WriteRTP accepts one packet from the caller's track.
+func (i *Ingest) WriteRTP(packet *rtp.Packet) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return nil
+	}
+
+	for _, p := range i.jitter.Push(packet) {
+		var (
+			n   int
+			err error
+		)
+		if p == nil {
+			n, err = i.decoder.Conceal(i.pcm)
+		} else {
+			var payload []byte
+			if payload, err = i.depacketizer.Unmarshal(p.Payload); err == nil {
+				n, err = i.decoder.Decode(payload, i.pcm)
+			}
+		}
+
+		if err != nil {
+			// Keep the timeline intact even when a packet cannot be decoded.
+			log.Printf("Ingest decode error: %v", err)
+			if n, err = i.decoder.Conceal(i.pcm); err != nil {
+				continue
+			}
+		}
+
+		frame := make([]int16, n)
+		copy(frame, i.pcm[:n])
+
+		select {
+		case i.frames <- frame:
+		default:
+			log.Printf("Ingest frame queue full, dropping %d samples", n)
+		}
+	}
+
+	return nil
+}
+
+// Close stops the ingest and closes Frames.
+func (i *Ingest) Close() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.closed {
+		return
+	}
+	i.closed = true
+	close(i.frames)
+}
@@ -0,0 +1,50 @@
+package media_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"voice-agent/fake"
+	"voice-agent/media"
+
+	"github.com/pion/rtp"
+)
+
+func TestIngest(t *testing.T) {
+	decoder, _ := fake.NewDecoder(media.IngestSampleRate, 1)
+	ingest := media.NewIngest(decoder)
+
+	// Fake packets are 20 ms of 8 kHz PCM; each carries its sequence
+	// number as the sample value so the frames can be told apart.
+	send := func(seq uint16) {
+		payload := make([]byte, 320)
+		for i := 0; i < len(payload); i += 2 {
+			binary.LittleEndian.PutUint16(payload[i:], seq)
+		}
+		ingest.WriteRTP(&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: seq}, Payload: payload})
+	}
+	for _, seq := range []uint16{1, 3, 2, 5, 6, 7, 8, 9, 10, 11} {
+		send(seq)
+	}
+	ingest.Close()
+
+	var got []int16
+	for frame := range ingest.Frames() {
+		if len(frame) != media.SamplesPerFrame(media.IngestSampleRate) {
+			t.Fatalf("frame of %d samples", len(frame))
+		}
+		got = append(got, frame[len(frame)/2])
+	}
+
+	// 4 never arrives and is concealed as silence; the reordered 2 and 3
+	// play in order.
+	want := []int16{1, 2, 3, 0, 5, 6}
+	if len(got) < len(want) {
+		t.Fatalf("frames %v, want %v first", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("frames %v, want %v first", got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package media
+
+import (
+	"github.com/pion/rtp"
+)
+
+const (
+	// maxSequenceJump is how far ahead a packet may land before the buffer
+	// assumes the sender restarted its sequence numbers.
+	maxSequenceJump = 1000
+
+	// maxLateRun is how many late packets in a row make the buffer assume
+	// the sender restarted at a lower sequence number. A stray duplicate or
+	// straggler is late once; a restarted stream is late every time.
+	maxLateRun = 10
+)
+
+// JitterBuffer reorders RTP packets by sequence number. It holds up to depth
+// out-of-order packets while waiting for a missing one, then gives up on the
+// gap and moves on. A new SSRC, such as after an ICE restart or
+// renegotiation, or a sender restarting its sequence numbers starts the
+// buffer over.
+type JitterBuffer struct {
+	depth   int
+	packets map[uint16]*rtp.Packet
+	next    uint16
+	ssrc    uint32
+	lateRun int
+	started bool
+}
+
+func NewJitterBuffer(depth int) *JitterBuffer {
+	if depth < 1 {
+		depth = 1
+	}
+
+	return &JitterBuffer{
+		depth:   depth,
+		packets: make(map[uint16]*rtp.Packet),
+	}
+}
+
+// Push adds a packet and returns the packets that are now ready for playout,
+// in sequence order. A nil entry marks a packet that was given up as lost.
+func (j *JitterBuffer) Push(packet *rtp.Packet) []*rtp.Packet {
+	seq := packet.SequenceNumber
+
+	var ready []*rtp.Packet
+	if j.started && packet.SSRC != j.ssrc {
+		ready = j.Flush()
+	}
+	if !j.started {
+		j.start(packet)
+	}
+
+	ahead := seq - j.next
+	if ahead >= 0x8000 {
+		// Late or duplicate: its slot has already been played out.
+		j.lateRun++
+		if j.lateRun < maxLateRun {
+			return ready
+		}
+		ready = append(ready, j.Flush()...)
+		j.start(packet)
+	} else if ahead > maxSequenceJump {
+		ready = append(ready, j.Flush()...)
+		j.start(packet)
+	}
+	j.lateRun = 0
+
+	j.packets[seq] = packet
+
+	for len(j.packets) > 0 {
+		if p, ok := j.packets[j.next]; ok {
+			ready = append(ready, p)
+			delete(j.packets, j.next)
+			j.next++
+			continue
+		}
+
+		if len(j.packets) <= j.depth {
+			break
+		}
+
+		ready = append(ready, nil)
+		j.next++
+	}
+
+	return ready
+}
+
+func (j *JitterBuffer) start(packet *rtp.Packet) {
+	j.next = packet.SequenceNumber
+	j.ssrc = packet.SSRC
+	j.lateRun = 0
+	j.started = true
+}
+
+// Flush returns every buffered packet in sequence order, with nil for the
+// gaps between them, and empties the buffer.
+func (j *JitterBuffer) Flush() []*rtp.Packet {
+	var ready []*rtp.Packet
+	for len(j.packets) > 0 {
+		ready = append(ready, j.packets[j.next])
+		delete(j.packets, j.next)
+		j.next++
+	}
+	j.Reset()
+	return ready
+}
+
+// Reset drops every buffered packet.
+func (j *JitterBuffer) Reset() {
+	j.packets = make(map[uint16]*rtp.Packet)
+	j.lateRun = 0
+	j.started = false
+}
@@ -0,0 +1,86 @@
+package media_test
+
+import (
+	"testing"
+
+	"voice-agent/media"
+
+	"github.com/pion/rtp"
+)
+
+func packet(ssrc uint32, seq uint16) *rtp.Packet {
+	return &rtp.Packet{Header: rtp.Header{SSRC: ssrc, SequenceNumber: seq}}
+}
+
+// push feeds sequence numbers from one SSRC and returns what was played
+// out, with -1 for packets given up as lost.
+func push(j *media.JitterBuffer, ssrc uint32, seqs ...uint16) []int {
+	var out []int
+	for _, seq := range seqs {
+		for _, p := range j.Push(packet(ssrc, seq)) {
+			if p == nil {
+				out = append(out, -1)
+			} else {
+				out = append(out, int(p.SequenceNumber))
+			}
+		}
+	}
+	return out
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestJitterBuffer(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		seqs []uint16
+		want []int
+	}{
+		{"in order", []uint16{10, 11, 12}, []int{10, 11, 12}},
+		{"reordered", []uint16{10, 12, 13, 11, 14}, []int{10, 11, 12, 13, 14}},
+		{"duplicate and late", []uint16{10, 11, 11, 10, 12}, []int{10, 11, 12}},
+		// Depth 3: the fourth packet past the gap gives up on 11.
+		{"loss", []uint16{10, 12, 13, 14, 15}, []int{10, -1, 12, 13, 14, 15}},
+		{"wraparound", []uint16{65534, 0, 65535, 1}, []int{65534, 65535, 0, 1}},
+		{"forward jump", []uint16{10, 11, 5000, 5001}, []int{10, 11, 5000, 5001}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := push(media.NewJitterBuffer(3), 1, tc.seqs...); !equal(got, tc.want) {
+				t.Errorf("played %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJitterBufferRestart(t *testing.T) {
+	j := media.NewJitterBuffer(3)
+	push(j, 1, 1000, 1001, 1002)
+
+	// A sender that restarts lower is late at first, then taken as a new
+	// stream once it keeps coming.
+	var seqs []uint16
+	for seq := uint16(100); seq < 115; seq++ {
+		seqs = append(seqs, seq)
+	}
+	got := push(j, 1, seqs...)
+	if len(got) == 0 || got[0] != 109 || got[len(got)-1] != 114 {
+		t.Fatalf("after restart played %v, want 109 to 114", got)
+	}
+
+	// A new SSRC starts over straight away, playing out what the old one
+	// left buffered and giving up on the gap before it.
+	push(j, 1, 116)
+	if got := push(j, 2, 7, 8); !equal(got, []int{-1, 116, 7, 8}) {
+		t.Errorf("after SSRC change played %v", got)
+	}
+}
@@ -0,0 +1,53 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+var oggMagic = []byte("OggS")
+
+const oggHeaderSize = 27
+
+// parseOgg moves whole pages from pending. The leading pages with granule
+// position zero carry the Opus headers and form the initialization
+// segment; later pages are media.
+func (s *Segmenter) parseOgg() error {
+	for len(s.pending) >= oggHeaderSize {
+		if string(s.pending[:4]) != string(oggMagic) {
+			return fmt.Errorf("%w: missing Ogg page header", ErrInvalidContainer)
+		}
+
+		segments := int(s.pending[26])
+		if len(s.pending) < oggHeaderSize+segments {
+			return nil
+		}
+		lacing := s.pending[oggHeaderSize : oggHeaderSize+segments]
+		size := oggHeaderSize + segments
+		for _, n := range lacing {
+			size += int(n)
+		}
+		if len(s.pending) < size {
+			return nil
+		}
+
+		page := s.pending[:size]
+		granule := binary.LittleEndian.Uint64(page[6:14])
+		if !s.haveInit && granule == 0 {
+			s.init = append(s.init, page...)
+			s.consume(size)
+			continue
+		}
+		s.haveInit = true
+
+		// A file may not start in the middle of a packet, so pages stay
+		// staged until the packet running off the end of them completes.
+		s.oggStaged = append(s.oggStaged, page...)
+		if segments == 0 || lacing[segments-1] < 255 {
+			s.ready = append(s.ready, s.oggStaged...)
+			s.oggStaged = s.oggStaged[:0]
+		}
+		s.consume(size)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package media converts call audio between WebRTC Opus RTP and PCM.
+//
+// Calls need libopus (-tags libopus, plus nolibopusfile when libopusfile is
+// not installed), which decodes every Opus mode browsers send and encodes
+// the agent's speech. The default build can do neither; the server refuses
+// to start with it.
+package media
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// OpusSampleRate is the RTP clock rate WebRTC uses for Opus.
+	OpusSampleRate = 48000
+
+	// FrameDuration is the packet duration used on the agent's tracks.
+	FrameDuration = 20 * time.Millisecond
+)
+
+// Decoder turns Opus packets into mono PCM at the rate it was created with.
+type Decoder interface {
+	// Decode decodes one packet into pcm and returns the number of samples.
+	Decode(packet []byte, pcm []int16) (int, error)
+
+	// Conceal fills pcm with a stand-in for one lost frame and returns the
+	// number of samples written.
+	Conceal(pcm []int16) (int, error)
+}
+
+// Encoder turns mono PCM frames at the rate it was created with into Opus
+// packets.
+type Encoder interface {
+	// Encode encodes one frame of pcm into packet and returns its length.
+	Encode(pcm []int16, packet []byte) (int, error)
+}
+
+var (
+	// ErrEncoderUnavailable is returned by NewEncoder in builds without libopus.
+	ErrEncoderUnavailable = errors.New("Opus encoding requires building with -tags libopus")
+
+	// ErrDecoderUnavailable is returned by NewDecoder in builds without libopus.
+	ErrDecoderUnavailable = errors.New("Opus decoding requires building with -tags libopus")
+)
+
+// SamplesPerFrame is the number of samples in one FrameDuration at sampleRate.
+func SamplesPerFrame(sampleRate int) int {
+	return sampleRate * int(FrameDuration/time.Millisecond) / 1000
+}
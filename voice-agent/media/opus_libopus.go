@@ -0,0 +1,39 @@
+//go:build libopus
+
+package media
+
+import (
+	"github.com/hraban/opus"
+)
+
+type libopusDecoder struct {
+	decoder    *opus.Decoder
+	sampleRate int
+}
+
+// NewDecoder creates an Opus decoder that outputs PCM at sampleRate.
+func NewDecoder(sampleRate, channels int) (Decoder, error) {
+	decoder, err := opus.NewDecoder(sampleRate, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	return &libopusDecoder{decoder: decoder, sampleRate: sampleRate}, nil
+}
+
+// NewEncoder creates an Opus encoder tuned for speech.
+func NewEncoder(sampleRate, channels int) (Encoder, error) {
+	return opus.NewEncoder(sampleRate, channels, opus.AppVoIP)
+}
+
+func (d *libopusDecoder) Decode(packet []byte, pcm []int16) (int, error) {
+	return d.decoder.Decode(packet, pcm)
+}
+
+func (d *libopusDecoder) Conceal(pcm []int16) (int, error) {
+	n := min(len(pcm), SamplesPerFrame(d.sampleRate))
+	if err := d.decoder.DecodePLC(pcm[:n]); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,15 @@
+//go:build !libopus
+
+package media
+
+// NewDecoder always fails: the only pure Go Opus decoder handles 20 ms
+// SILK-mode packets, while browsers send hybrid and CELT packets at 48 kHz.
+// Decoding those as silence would leave the agent deaf to most callers.
+func NewDecoder(sampleRate, channels int) (Decoder, error) {
+	return nil, ErrDecoderUnavailable
+}
+
+// NewEncoder always fails: there is no pure Go Opus encoder.
+func NewEncoder(sampleRate, channels int) (Encoder, error) {
+	return nil, ErrEncoderUnavailable
+}
@@ -0,0 +1,71 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Resample converts mono PCM from one sample rate to another. Integer
+// down-sampling averages each group of samples; everything else uses linear
+// interpolation, which is adequate for speech.
+func Resample(in []int16, from, to int) []int16 {
+	if from == to || len(in) == 0 {
+		return in
+	}
+
+	if from > to && from%to == 0 {
+		factor := from / to
+		out := make([]int16, len(in)/factor)
+		for i := range out {
+			var sum int
+			for _, v := range in[i*factor : (i+1)*factor] {
+				sum += int(v)
+			}
+			out[i] = int16(sum / factor)
+		}
+		return out
+	}
+
+	out := make([]int16, int(int64(len(in))*int64(to)/int64(from)))
+	step := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		a := float64(in[j])
+		b := a
+		if j+1 < len(in) {
+			b = float64(in[j+1])
+		}
+		out[i] = int16(a + (b-a)*(pos-float64(j)))
+	}
+	return out
+}
+
+// EncodeWAV wraps mono 16-bit PCM in a WAV container.
+func EncodeWAV(pcm []int16, sampleRate int) []byte {
+	return EncodeWAVChannels(pcm, sampleRate, 1)
+}
+
+// EncodeWAVChannels wraps interleaved 16-bit PCM with the given number of
+// channels in a WAV container.
+func EncodeWAVChannels(pcm []int16, sampleRate, channels int) []byte {
+	dataSize := uint32(len(pcm) * 2)
+	blockAlign := channels * 2
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, 36+dataSize)
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, dataSize)
+	binary.Write(&buf, binary.LittleEndian, pcm)
+	return buf.Bytes()
+}
@@ -0,0 +1,136 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ErrInvalidContainer is returned when recorder output cannot be parsed.
+var ErrInvalidContainer = errors.New("invalid media container")
+
+type containerFormat int
+
+const (
+	formatUnknown containerFormat = iota
+	formatWebM
+	formatOgg
+	formatRaw
+)
+
+// Segmenter cuts a browser MediaRecorder stream, posted in arbitrary chunks,
+// into files that can each be decoded on their own. WebM streams are cut on
+// cluster boundaries and Ogg streams on page boundaries, and every file
+// starts with the stream's initialization segment (the EBML header and
+// track info, or the Opus header pages). Streams in any other format are
+// passed through as received.
+type Segmenter struct {
+	format containerFormat
+	// pending holds bytes not yet parsed into whole elements or pages.
+	pending []byte
+	// init is the initialization segment, once complete.
+	init     []byte
+	haveInit bool
+	// ready holds whole clusters or pages not yet cut.
+	ready []byte
+
+	webm webmState
+	// oggStaged holds pages ending in a packet that continues on the
+	// next page.
+	oggStaged []byte
+}
+
+func NewSegmenter() *Segmenter {
+	return &Segmenter{}
+}
+
+// Write adds recorder output. It fails only when the stream is not the
+// container it started as.
+func (s *Segmenter) Write(p []byte) (int, error) {
+	s.pending = append(s.pending, p...)
+
+	if s.format == formatUnknown {
+		switch {
+		case len(s.pending) < 4:
+			return len(p), nil
+		case bytes.HasPrefix(s.pending, ebmlMagic):
+			s.format = formatWebM
+		case bytes.HasPrefix(s.pending, oggMagic):
+			s.format = formatOgg
+		default:
+			s.format = formatRaw
+		}
+	}
+
+	var err error
+	switch s.format {
+	case formatWebM:
+		err = s.parseWebM()
+	case formatOgg:
+		err = s.parseOgg()
+	case formatRaw:
+		s.ready = append(s.ready, s.pending...)
+		s.pending = s.pending[:0]
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Buffered returns the size of the media ready to be cut.
+func (s *Segmenter) Buffered() int {
+	return len(s.ready)
+}
+
+// Cut returns a file holding the initialization segment and all media
+// ready so far, or nil when there is none. Bytes of an incomplete cluster or
+// page stay buffered for the next file.
+func (s *Segmenter) Cut() []byte {
+	file := s.Snapshot()
+	s.ready = s.ready[:0]
+	return file
+}
+
+// Snapshot returns the file Cut would return without consuming the media,
+// so the utterance in progress can be transcribed before it is complete.
+func (s *Segmenter) Snapshot() []byte {
+	if len(s.ready) == 0 || (s.format != formatRaw && !s.haveInit) {
+		return nil
+	}
+
+	file := make([]byte, 0, len(s.init)+len(s.ready))
+	file = append(file, s.init...)
+	return append(file, s.ready...)
+}
+
+// Discard drops the first n bytes of ready media, such as media already
+// transcribed from a Snapshot that held n bytes of it. Ready media only
+// grows by whole clusters or pages, so the rest still starts on one.
+func (s *Segmenter) Discard(n int) {
+	n = min(n, len(s.ready))
+	s.ready = append(s.ready[:0], s.ready[n:]...)
+}
+
+// Finish marks the end of the recording. A WebM cluster of unknown size
+// only ends where the next one starts, so the last cluster becomes ready
+// here, provided all of its children arrived.
+func (s *Segmenter) Finish() {
+	if s.format != formatWebM {
+		return
+	}
+	if err := s.parseWebM(); err != nil {
+		return
+	}
+	if s.webm.cluster > 0 && s.webm.clusterEnd == 0 {
+		s.finishCluster(s.webm.cluster)
+	}
+}
+
+// Filename returns a name whose extension tells a transcription API the
+// format of the files Cut returns.
+func (s *Segmenter) Filename() string {
+	if s.format == formatOgg {
+		return "audio.ogg"
+	}
+	return "audio.webm"
+}
@@ -0,0 +1,222 @@
+package media_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"voice-agent/media"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+// ebmlElement encodes an element with a one- to four-byte id and an
+// eight-byte size field holding the length of its children.
+func ebmlElement(id uint32, children ...[]byte) []byte {
+	data := bytes.Join(children, nil)
+	return append(ebmlHeader(id, uint64(len(data))), data...)
+}
+
+// unknownSizeElement encodes the header of an element of unknown size, as
+// live recorders write for the Segment and its clusters.
+func unknownSizeElement(id uint32) []byte {
+	return ebmlHeader(id, 0x00FFFFFFFFFFFFFF)
+}
+
+func ebmlHeader(id uint32, size uint64) []byte {
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	return binary.BigEndian.AppendUint64(out, 0x0100000000000000|size)
+}
+
+// recorderWebM builds a stream shaped like Chrome's MediaRecorder output: a
+// Segment and clusters of unknown size.
+func recorderWebM(clusters int) (init []byte, stream []byte, clusterData [][]byte) {
+	init = bytes.Join([][]byte{
+		ebmlElement(0x1A45DFA3, ebmlElement(0x4282, []byte("webm"))),
+		unknownSizeElement(0x18538067),
+		ebmlElement(0x1549A966, ebmlElement(0x2AD7B1, []byte{0x0F, 0x42, 0x40})),
+		ebmlElement(0x1654AE6B, ebmlElement(0xAE, bytes.Repeat([]byte{1}, 20))),
+	}, nil)
+
+	stream = append([]byte{}, init...)
+	for i := 0; i < clusters; i++ {
+		cluster := append(unknownSizeElement(0x1F43B675), ebmlElement(0xE7, []byte{byte(i)})...)
+		for j := 0; j < 5; j++ {
+			cluster = append(cluster, ebmlElement(0xA3, bytes.Repeat([]byte{byte(i)}, 100))...)
+		}
+		clusterData = append(clusterData, cluster)
+		stream = append(stream, cluster...)
+	}
+	return init, stream, clusterData
+}
+
+// writeChunks feeds stream to the segmenter in chunks that ignore element
+// boundaries, as MediaRecorder's timeslices do.
+func writeChunks(t *testing.T, s *media.Segmenter, stream []byte, chunk int) {
+	t.Helper()
+	for len(stream) > 0 {
+		n := chunk
+		if n > len(stream) {
+			n = len(stream)
+		}
+		if _, err := s.Write(stream[:n]); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		stream = stream[n:]
+	}
+}
+
+func TestSegmenterWebM(t *testing.T) {
+	init, stream, clusters := recorderWebM(4)
+
+	s := media.NewSegmenter()
+	writeChunks(t, s, stream[:len(stream)-50], 97)
+
+	if s.Filename() != "audio.webm" {
+		t.Errorf("Filename() = %q, want audio.webm", s.Filename())
+	}
+
+	// The last cluster has no following element yet, so only the first
+	// three are complete.
+	first := s.Cut()
+	want := append(append([]byte{}, init...), bytes.Join(clusters[:3], nil)...)
+	if !bytes.Equal(first, want) {
+		t.Fatalf("first file is %d bytes, want init and three clusters (%d bytes)", len(first), len(want))
+	}
+	if s.Cut() != nil {
+		t.Fatal("second Cut returned data with nothing new buffered")
+	}
+
+	// A new cluster ends the open one, and the next file starts with the
+	// initialization segment again.
+	writeChunks(t, s, stream[len(stream)-50:], 97)
+	next := append(unknownSizeElement(0x1F43B675), ebmlElement(0xE7, []byte{9})...)
+	writeChunks(t, s, next, 97)
+
+	second := s.Cut()
+	want = append(append([]byte{}, init...), clusters[3]...)
+	if !bytes.Equal(second, want) {
+		t.Fatalf("second file is %d bytes, want init and the fourth cluster (%d bytes)", len(second), len(want))
+	}
+}
+
+func TestSegmenterWebMKnownSize(t *testing.T) {
+	header := ebmlElement(0x1A45DFA3, ebmlElement(0x4282, []byte("webm")))
+	tracks := ebmlElement(0x1654AE6B, ebmlElement(0xAE, []byte{1, 2, 3}))
+	cluster := ebmlElement(0x1F43B675, ebmlElement(0xA3, bytes.Repeat([]byte{7}, 40)))
+	stream := append(append([]byte{}, header...), ebmlElement(0x18538067, tracks, cluster)...)
+
+	s := media.NewSegmenter()
+	writeChunks(t, s, stream, 5)
+
+	// The Segment's size is rewritten as unknown so a file holding only
+	// some clusters stays valid.
+	file := s.Cut()
+	want := bytes.Join([][]byte{header, unknownSizeElement(0x18538067), tracks, cluster}, nil)
+	if !bytes.Equal(file, want) {
+		t.Fatalf("file = %x, want %x", file, want)
+	}
+}
+
+func TestSegmenterOgg(t *testing.T) {
+	var stream bytes.Buffer
+	writer, err := oggwriter.NewWith(&stream, 48000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := stream.Len()
+
+	for i := 0; i < 10; i++ {
+		packet := &rtp.Packet{
+			Header:  rtp.Header{Timestamp: uint32(960 * (i + 1))},
+			Payload: bytes.Repeat([]byte{byte(i)}, 80),
+		}
+		if err := writer.WriteRTP(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := stream.Bytes()
+	pageSize := (len(data) - headers) / 10
+
+	s := media.NewSegmenter()
+	writeChunks(t, s, data[:headers+5*pageSize+10], 33)
+
+	if s.Filename() != "audio.ogg" {
+		t.Errorf("Filename() = %q, want audio.ogg", s.Filename())
+	}
+	if s.Buffered() != 5*pageSize {
+		t.Fatalf("Buffered() = %d, want five pages (%d)", s.Buffered(), 5*pageSize)
+	}
+
+	first := s.Cut()
+	if !bytes.Equal(first, data[:headers+5*pageSize]) {
+		t.Fatal("first file is not the headers and the first five pages")
+	}
+
+	writeChunks(t, s, data[headers+5*pageSize+10:], 33)
+	second := s.Cut()
+	want := append(append([]byte{}, data[:headers]...), data[headers+5*pageSize:]...)
+	if !bytes.Equal(second, want) {
+		t.Fatal("second file is not the headers and the last five pages")
+	}
+}
+
+func TestSegmenterOtherFormats(t *testing.T) {
+	s := media.NewSegmenter()
+	writeChunks(t, s, []byte("RIFF....WAVEfmt "), 3)
+
+	if s.Buffered() != 16 {
+		t.Fatalf("Buffered() = %d, want 16", s.Buffered())
+	}
+	if got := s.Cut(); string(got) != "RIFF....WAVEfmt " {
+		t.Fatalf("Cut() = %q", got)
+	}
+}
+
+func TestSegmenterDiscard(t *testing.T) {
+	init, stream, clusters := recorderWebM(4)
+
+	s := media.NewSegmenter()
+	writeChunks(t, s, stream, 97)
+
+	// Drop the two clusters a snapshot held; the file that follows starts
+	// with the initialization segment and the third cluster.
+	s.Discard(len(clusters[0]) + len(clusters[1]))
+	want := append(append([]byte{}, init...), clusters[2]...)
+	if got := s.Cut(); !bytes.Equal(got, want) {
+		t.Fatalf("file is %d bytes, want init and the third cluster (%d bytes)", len(got), len(want))
+	}
+
+	s.Discard(10)
+	if s.Buffered() != 0 {
+		t.Errorf("Buffered() = %d after discarding more than was ready", s.Buffered())
+	}
+}
+
+func TestSegmenterRejectsCorruptWebM(t *testing.T) {
+	s := media.NewSegmenter()
+	stream := append(ebmlElement(0x1A45DFA3), ebmlElement(0x1549A966)...)
+	if _, err := s.Write(stream); err == nil {
+		t.Fatal("Write accepted an element outside the Segment")
+	}
+}
+
+func TestSegmenterFinish(t *testing.T) {
+	init, stream, clusters := recorderWebM(2)
+
+	s := media.NewSegmenter()
+	writeChunks(t, s, stream, 64)
+
+	// The last cluster of a stopped recording has nothing after it.
+	s.Finish()
+	want := append(append([]byte{}, init...), bytes.Join(clusters, nil)...)
+	if got := s.Cut(); !bytes.Equal(got, want) {
+		t.Fatalf("file is %d bytes, want both clusters (%d bytes)", len(got), len(want))
+	}
+}
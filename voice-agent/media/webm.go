@@ -0,0 +1,218 @@
+package media
+
+import "fmt"
+
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// Matroska element IDs, with their length marker bits, that the segmenter
+// needs to recognise.
+const (
+	ebmlHeaderID = 0x1A45DFA3
+	segmentID    = 0x18538067
+	clusterID    = 0x1F43B675
+	cuesID       = 0x1C53BB6B
+	tagsID       = 0x1254C367
+	chaptersID   = 0x1043A770
+	attachmentID = 0x1941A469
+	seekHeadID   = 0x114D9B74
+	infoID       = 0x1549A966
+	tracksID     = 0x1654AE6B
+)
+
+// unknownSize is written for the Segment so that a file holding only some
+// of its clusters is still valid.
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+type webmState struct {
+	inSegment bool
+	// cluster is the length, within pending, of the cluster being
+	// scanned: its header plus the children seen so far. It is zero when
+	// no cluster is open.
+	cluster int
+	// clusterEnd is the total length of a cluster of known size.
+	clusterEnd int
+}
+
+// isTopLevel reports whether id is an element that lives directly in the
+// Segment, which also ends a cluster of unknown size.
+func isTopLevel(id uint64) bool {
+	switch id {
+	case clusterID, cuesID, tagsID, chaptersID, attachmentID, seekHeadID, infoID, tracksID:
+		return true
+	}
+	return false
+}
+
+func (s *Segmenter) parseWebM() error {
+	for {
+		progressed, err := s.stepWebM()
+		if err != nil || !progressed {
+			return err
+		}
+	}
+}
+
+// stepWebM consumes one element or cluster child from pending and reports
+// whether it made progress.
+func (s *Segmenter) stepWebM() (bool, error) {
+	st := &s.webm
+
+	if st.cluster > 0 {
+		return s.scanCluster()
+	}
+
+	id, idLen, ok := readVintID(s.pending)
+	if !ok {
+		return false, nil
+	}
+	size, sizeLen, ok := readVintSize(s.pending[idLen:])
+	if !ok {
+		return false, nil
+	}
+	header := idLen + sizeLen
+
+	switch {
+	case !st.inSegment && id == ebmlHeaderID:
+		if size < 0 || len(s.pending) < header+int(size) {
+			return false, nil
+		}
+		s.init = append(s.init, s.pending[:header+int(size)]...)
+		s.consume(header + int(size))
+
+	case !st.inSegment && id == segmentID:
+		// Only the Segment header is taken; its children follow.
+		s.init = append(s.init, s.pending[:idLen]...)
+		s.init = append(s.init, unknownSize...)
+		st.inSegment = true
+		s.consume(header)
+
+	case !st.inSegment:
+		return false, fmt.Errorf("%w: unexpected WebM element %#x", ErrInvalidContainer, id)
+
+	case id == clusterID:
+		s.haveInit = true
+		if size >= 0 {
+			st.clusterEnd = header + int(size)
+		} else {
+			st.clusterEnd = 0
+		}
+		st.cluster = header
+		return true, nil
+
+	default:
+		if size < 0 {
+			return false, fmt.Errorf("%w: WebM element %#x of unknown size", ErrInvalidContainer, id)
+		}
+		if len(s.pending) < header+int(size) {
+			return false, nil
+		}
+		// Track setup before the first cluster is part of the
+		// initialization segment; anything after it, such as cues
+		// written when recording stops, is dropped.
+		if !s.haveInit {
+			s.init = append(s.init, s.pending[:header+int(size)]...)
+		}
+		s.consume(header + int(size))
+	}
+	return true, nil
+}
+
+// scanCluster advances through the open cluster. A cluster of known size
+// is complete once all of it has arrived; one of unknown size ends where
+// the next top-level element starts.
+func (s *Segmenter) scanCluster() (bool, error) {
+	st := &s.webm
+
+	if st.clusterEnd > 0 {
+		if len(s.pending) < st.clusterEnd {
+			return false, nil
+		}
+		s.finishCluster(st.clusterEnd)
+		return true, nil
+	}
+
+	rest := s.pending[st.cluster:]
+	id, idLen, ok := readVintID(rest)
+	if !ok {
+		return false, nil
+	}
+	if isTopLevel(id) {
+		s.finishCluster(st.cluster)
+		return true, nil
+	}
+
+	size, sizeLen, ok := readVintSize(rest[idLen:])
+	if !ok {
+		return false, nil
+	}
+	if size < 0 {
+		return false, fmt.Errorf("%w: cluster child %#x of unknown size", ErrInvalidContainer, id)
+	}
+	if len(rest) < idLen+sizeLen+int(size) {
+		return false, nil
+	}
+	st.cluster += idLen + sizeLen + int(size)
+	return true, nil
+}
+
+func (s *Segmenter) finishCluster(n int) {
+	s.ready = append(s.ready, s.pending[:n]...)
+	s.consume(n)
+	s.webm.cluster = 0
+	s.webm.clusterEnd = 0
+}
+
+func (s *Segmenter) consume(n int) {
+	s.pending = append(s.pending[:0], s.pending[n:]...)
+}
+
+// readVintID reads an EBML element ID, keeping its length marker bits.
+func readVintID(p []byte) (uint64, int, bool) {
+	if len(p) == 0 {
+		return 0, 0, false
+	}
+	n := vintLength(p[0])
+	if n == 0 || n > 4 || len(p) < n {
+		return 0, 0, false
+	}
+
+	var id uint64
+	for _, b := range p[:n] {
+		id = id<<8 | uint64(b)
+	}
+	return id, n, true
+}
+
+// readVintSize reads an EBML data size. It returns -1 for the reserved
+// "unknown size" value.
+func readVintSize(p []byte) (int64, int, bool) {
+	if len(p) == 0 {
+		return 0, 0, false
+	}
+	n := vintLength(p[0])
+	if n == 0 || len(p) < n {
+		return 0, 0, false
+	}
+
+	value := uint64(p[0]) & (0xFF >> n)
+	allOnes := value == 0xFF>>n
+	for _, b := range p[1:n] {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if allOnes {
+		return -1, n, true
+	}
+	return int64(value), n, true
+}
+
+// vintLength returns the length of the variable-size integer starting with
+// b, from the position of its first set bit, or 0 if b is zero.
+func vintLength(b byte) int {
+	for n := 1; n <= 8; n++ {
+		if b&(0x80>>(n-1)) != 0 {
+			return n
+		}
+	}
+	return 0
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pion/rtp"
 	"github.com/pion/webrtc/v4"
 )
 
@@ -24,6 +25,21 @@ type Participant struct {
 	IsAgent         bool
 	JoinedAt        time.Time
 	mutex           sync.RWMutex
+	rtpSinks        []RTPSink
+
+	// ICE candidates gathered for PeerConnection since gathering last
+	// started, for trickling to the client. candidatesChanged is closed and
+	// replaced when one arrives or gathering starts again.
+	localCandidates   []webrtc.ICECandidateInit
+	gatheringDone     bool
+	candidatesChanged chan struct{}
+
+	onICEDisconnected func()
+}
+
+// RTPSink receives every packet read from a participant's remote track.
+type RTPSink interface {
+	WriteRTP(packet *rtp.Packet) error
 }
 
 type SignalMessage struct {
@@ -37,6 +53,33 @@ type SignalMessage struct {
 
 type PhoneNumberRequest struct {
 	PhoneNumber string `json:"phone_number"`
+	// Voice overrides the configured agent voice for this session.
+	Voice *VoiceRequest `json:"voice,omitempty"`
+	// Vocabulary adds names and terms, such as the caller's family
+	// members, that speech recognition should expect in this session.
+	Vocabulary []string `json:"vocabulary,omitempty"`
+	// Language is "en", "hi", or "auto" to follow the caller; it defaults to
+	// the configured language.
+	Language string `json:"language,omitempty"`
+}
+
+// VoiceRequest chooses how the agent sounds in a session. Fields left
+// unset keep the configured voice. OutputFormat is a vendor format name
+// such as "pcm_24000", and Speed scales the speaking rate.
+type VoiceRequest struct {
+	VoiceID      string                `json:"voice_id,omitempty"`
+	ModelID      string                `json:"model_id,omitempty"`
+	OutputFormat string                `json:"output_format,omitempty"`
+	Speed        float64               `json:"speed,omitempty"`
+	Settings     *VoiceSettingsRequest `json:"voice_settings,omitempty"`
+}
+
+// VoiceSettingsRequest tunes the session's voice.
+type VoiceSettingsRequest struct {
+	Stability       *float64 `json:"stability,omitempty"`
+	SimilarityBoost *float64 `json:"similarity_boost,omitempty"`
+	Style           *float64 `json:"style,omitempty"`
+	UseSpeakerBoost *bool    `json:"use_speaker_boost,omitempty"`
 }
 
 type PhoneNumberResponse struct {
@@ -50,6 +93,65 @@ type TranscriptMessage struct {
 	Speaker   string    `json:"speaker"`
 	Text      string    `json:"text"`
 	Timestamp time.Time `json:"timestamp"`
+	// Start and End place the speech on the call timeline, in seconds
+	// since the agent started listening. They are set when the
+	// transcriber reports timings.
+	Start *float64 `json:"start,omitempty"`
+	End   *float64 `json:"end,omitempty"`
+	// Confidence is the transcriber's confidence, from 0 to 1, when it
+	// reports one.
+	Confidence *float64 `json:"confidence,omitempty"`
+}
+
+// TranscriptEntry is a transcript message as stored for a call.
+type TranscriptEntry struct {
+	RoomID    string `json:"room_id"`
+	SessionID string `json:"session_id"`
+	TranscriptMessage
+}
+
+// CallSummary is the write-up of a finished call for the service desk.
+// Disposition is one of the codes in package summary.
+type CallSummary struct {
+	RoomID            string    `json:"room_id"`
+	SessionID         string    `json:"session_id"`
+	CallerIntent      string    `json:"caller_intent"`
+	PolicyNumber      string    `json:"policy_number,omitempty"`
+	QuestionsAnswered []string  `json:"questions_answered"`
+	UnresolvedItems   []string  `json:"unresolved_items"`
+	FollowUpNeeded    bool      `json:"follow_up_needed"`
+	FollowUp          string    `json:"follow_up,omitempty"`
+	Disposition       string    `json:"disposition"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// TranscriptResponse is a call's transcript, oldest message first.
+type TranscriptResponse struct {
+	RoomID   string            `json:"room_id"`
+	Messages []TranscriptEntry `json:"messages"`
+}
+
+// EventMessage tells the caller's client about something other than speech,
+// such as the agent escalating the call.
+type EventMessage struct {
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// STTEvent is sent to clients of the streaming transcription endpoint.
+// Type is "partial" for a hypothesis that may still change, "final" for a
+// finished utterance, or "error".
+type STTEvent struct {
+	Type      string    `json:"type"`
+	SessionID string    `json:"session_id"`
+	RoomID    string    `json:"room_id,omitempty"`
+	Text      string    `json:"text,omitempty"`
+	// Unclear is set, and Text left empty, when the audio held speech too
+	// unclear to act on.
+	Unclear   bool      `json:"unclear,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 func NewRoom(id string) *Room {
@@ -72,6 +174,112 @@ func (r *Room) RemoveParticipant(id string) {
 	delete(r.Participants, id)
 }
 
+// GetParticipant returns the participant with the given ID, if it is in
+// the room.
+func (r *Room) GetParticipant(id string) (*Participant, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	p, ok := r.Participants[id]
+	return p, ok
+}
+
+func (p *Participant) AddRTPSink(sink RTPSink) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.rtpSinks = append(p.rtpSinks, sink)
+}
+
+func (p *Participant) GetRTPSinks() []RTPSink {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	sinks := make([]RTPSink, len(p.rtpSinks))
+	copy(sinks, p.rtpSinks)
+	return sinks
+}
+
+// SetDataChannel records the data channel the participant opened. It is
+// called from pion's callbacks while other goroutines may be sending.
+func (p *Participant) SetDataChannel(dc *webrtc.DataChannel) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.DataChannel = dc
+}
+
+// AddLocalCandidate records a candidate gathered for the participant's
+// peer connection. A nil candidate marks the end of gathering.
+func (p *Participant) AddLocalCandidate(candidate *webrtc.ICECandidate) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if candidate == nil {
+		p.gatheringDone = true
+	} else {
+		p.localCandidates = append(p.localCandidates, candidate.ToJSON())
+	}
+	if p.candidatesChanged != nil {
+		close(p.candidatesChanged)
+		p.candidatesChanged = nil
+	}
+}
+
+// ResetLocalCandidates forgets the gathered candidates when the peer
+// connection starts gathering again, as it does for a new local description
+// that restarts ICE.
+func (p *Participant) ResetLocalCandidates() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.localCandidates = nil
+	p.gatheringDone = false
+	if p.candidatesChanged != nil {
+		close(p.candidatesChanged)
+		p.candidatesChanged = nil
+	}
+}
+
+// LocalCandidates returns the gathered candidates after the first n,
+// whether gathering has finished, and a channel that is closed when there
+// is more to report.
+func (p *Participant) LocalCandidates(n int) ([]webrtc.ICECandidateInit, bool, <-chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var candidates []webrtc.ICECandidateInit
+	if n < len(p.localCandidates) {
+		candidates = append(candidates, p.localCandidates[n:]...)
+	}
+	if p.candidatesChanged == nil {
+		p.candidatesChanged = make(chan struct{})
+	}
+	return candidates, p.gatheringDone, p.candidatesChanged
+}
+
+// OnICEDisconnected sets f to be called when the participant's peer
+// connection loses connectivity, which an ICE restart may recover.
+func (p *Participant) OnICEDisconnected(f func()) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.onICEDisconnected = f
+}
+
+// ICEDisconnected calls the function set with OnICEDisconnected, if any.
+func (p *Participant) ICEDisconnected() {
+	p.mutex.RLock()
+	f := p.onICEDisconnected
+	p.mutex.RUnlock()
+
+	if f != nil {
+		f()
+	}
+}
+
+func (p *Participant) GetDataChannel() *webrtc.DataChannel {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.DataChannel
+}
+
 func (r *Room) GetParticipants() []*Participant {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
@@ -0,0 +1,110 @@
+package recording
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"voice-agent/media"
+
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+)
+
+// mixSampleRate is the rate of the stereo mix, which is enough for speech.
+const mixSampleRate = 16000
+
+// writeMix decodes the user and agent recordings and writes them to MixFile
+// as the left and right channels of one WAV file, each placed at its offset
+// on the call timeline.
+func writeMix(dir string, tracks []TrackInfo, newDecoder func(sampleRate, channels int) (media.Decoder, error)) error {
+	var channels [2][]int16
+	for _, track := range tracks {
+		channel := -1
+		switch track.Speaker {
+		case User:
+			channel = 0
+		case Agent:
+			channel = 1
+		}
+		if channel < 0 || track.File == "" {
+			continue
+		}
+
+		decoder, err := newDecoder(mixSampleRate, 1)
+		if err != nil {
+			return err
+		}
+		offset := int(track.OffsetMs * mixSampleRate / 1000)
+		pcm, err := decodeTrack(filepath.Join(dir, track.File), decoder, offset)
+		if err != nil {
+			return err
+		}
+		channels[channel] = pcm
+	}
+
+	length := max(len(channels[0]), len(channels[1]))
+	stereo := make([]int16, length*2)
+	for channel, pcm := range channels {
+		for i, v := range pcm {
+			stereo[i*2+channel] = v
+		}
+	}
+	return os.WriteFile(filepath.Join(dir, MixFile), media.EncodeWAVChannels(stereo, mixSampleRate, 2), 0o644)
+}
+
+// decodeTrack decodes an Ogg/Opus recording to PCM at mixSampleRate,
+// starting offset samples in. Each packet is placed by its granule position,
+// so silence the sender did not transmit stays in the timeline.
+func decodeTrack(path string, decoder media.Decoder, offset int) ([]int16, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader, _, err := oggreader.NewWith(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		pcm     []int16
+		frame   = make([]int16, mixSampleRate*120/1000)
+		base    uint64
+		started bool
+	)
+	for {
+		packet, header, err := reader.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			return pcm, nil
+		}
+		if err != nil {
+			// A file cut short, say by a crash, still mixes up to there.
+			log.Printf("Recording mix: %s: %v", filepath.Base(path), err)
+			return pcm, nil
+		}
+		// Header pages, OpusHead and OpusTags, have no position.
+		if header.GranulePosition == 0 {
+			continue
+		}
+		if !started {
+			base = header.GranulePosition
+			started = true
+		}
+
+		n, err := decoder.Decode(packet, frame)
+		if err != nil {
+			log.Printf("Recording mix: %s: %v", filepath.Base(path), err)
+			if n, err = decoder.Conceal(frame); err != nil {
+				continue
+			}
+		}
+
+		at := offset + int((header.GranulePosition-base)*mixSampleRate/media.OpusSampleRate)
+		if end := at + n; end > len(pcm) {
+			pcm = append(pcm, make([]int16, end-len(pcm))...)
+		}
+		copy(pcm[at:], frame[:n])
+	}
+}
@@ -0,0 +1,266 @@
+// Package recording writes calls to disk for QA and compliance review.
+//
+// Every participant's audio is saved as it was sent, as Ogg/Opus without
+// transcoding, in a directory per call. A manifest records who was on the
+// call and where each file starts on the call timeline, and an optional
+// stereo mix puts the caller and the agent on separate channels.
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"voice-agent/media"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggwriter"
+)
+
+const (
+	// ManifestFile is the name of the manifest in each call's directory.
+	ManifestFile = "manifest.json"
+
+	// MixFile is the name of the stereo mix in each call's directory.
+	MixFile = "mix.wav"
+
+	// Speakers, as in transcript messages. The mix puts the user on the
+	// left channel and the agent on the right.
+	User  = "user"
+	Agent = "agent"
+
+	// jitterDepth is how many packets a track holds back to put
+	// out-of-order packets right before they are written.
+	jitterDepth = 5
+)
+
+// Manifest describes one recorded call.
+type Manifest struct {
+	RoomID    string      `json:"room_id"`
+	StartedAt time.Time   `json:"started_at"`
+	EndedAt   time.Time   `json:"ended_at"`
+	Tracks    []TrackInfo `json:"tracks"`
+	// Mix is the stereo file, if one was written.
+	Mix string `json:"mix,omitempty"`
+}
+
+// TrackInfo describes one participant's recording. Files are named relative
+// to the manifest. A track that never received audio has no file.
+type TrackInfo struct {
+	ParticipantID string     `json:"participant_id"`
+	Speaker       string     `json:"speaker"`
+	File          string     `json:"file,omitempty"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	// OffsetMs is where the file starts on the call timeline, in
+	// milliseconds after the manifest's StartedAt.
+	OffsetMs   int64 `json:"offset_ms"`
+	DurationMs int64 `json:"duration_ms"`
+	Packets    int   `json:"packets"`
+}
+
+// Recorder records one call. Tracks are added as participants join and
+// everything is written out by Close.
+type Recorder struct {
+	dir     string
+	roomID  string
+	started time.Time
+
+	mu         sync.Mutex
+	tracks     []*Track
+	newDecoder func(sampleRate, channels int) (media.Decoder, error)
+	closed     bool
+}
+
+// New starts recording the room into its own directory under dir.
+func New(dir, roomID string) (*Recorder, error) {
+	dir = filepath.Join(dir, roomID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Recorder{
+		dir:     dir,
+		roomID:  roomID,
+		started: time.Now(),
+	}, nil
+}
+
+// Dir is the directory the call is recorded in.
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// EnableMix makes Close write a stereo mix of the user and agent tracks,
+// decoded with decoders from newDecoder.
+func (r *Recorder) EnableMix(newDecoder func(sampleRate, channels int) (media.Decoder, error)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.newDecoder = newDecoder
+}
+
+// Track adds a recording of one participant's audio. The returned track
+// takes RTP packets from a remote track's sinks or an outbound writer.
+func (r *Recorder) Track(participantID, speaker string) *Track {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := &Track{
+		participantID: participantID,
+		speaker:       speaker,
+		file:          fmt.Sprintf("%s-%s.ogg", speaker, participantID),
+		dir:           r.dir,
+		jitter:        media.NewJitterBuffer(jitterDepth),
+	}
+	r.tracks = append(r.tracks, t)
+	return t
+}
+
+// Close finishes every track and writes the mix, if enabled, and the
+// manifest. Packets that arrive afterwards are dropped.
+func (r *Recorder) Close() (*Manifest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil, fmt.Errorf("recording of room %s already closed", r.roomID)
+	}
+	r.closed = true
+
+	manifest := &Manifest{
+		RoomID:    r.roomID,
+		StartedAt: r.started,
+		EndedAt:   time.Now(),
+	}
+	for _, t := range r.tracks {
+		manifest.Tracks = append(manifest.Tracks, t.close(r.started))
+	}
+
+	if r.newDecoder != nil {
+		if err := writeMix(r.dir, manifest.Tracks, r.newDecoder); err != nil {
+			log.Printf("Recording mix failed for room %s: %v", r.roomID, err)
+		} else {
+			manifest.Mix = MixFile
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, ManifestFile), data, 0o644); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Track writes one participant's Opus packets to an Ogg file. The file is
+// created when the first packet arrives, so its start time is when the
+// participant's audio started. Write errors stop the track rather than the
+// call.
+type Track struct {
+	participantID string
+	speaker       string
+	file          string
+	dir           string
+
+	mu      sync.Mutex
+	jitter  *media.JitterBuffer
+	writer  *oggwriter.OggWriter
+	started time.Time
+	first   uint32
+	last    uint32
+	packets int
+	failed  bool
+	closed  bool
+}
+
+// WriteRTP records one packet. It never fails, so a recording problem
+// cannot interrupt the audio it is recording.
+func (t *Track) WriteRTP(packet *rtp.Packet) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed || t.failed {
+		return nil
+	}
+
+	if t.writer == nil {
+		// The writer gets the file as a plain stream: given a path, it
+		// rewrites the last page on Close to mark the end of the stream,
+		// and corrupts it when the packet needed more than one segment.
+		// Players take the end of the file as the end of the stream.
+		file, err := os.Create(filepath.Join(t.dir, t.file))
+		if err != nil {
+			t.fail(err)
+			return nil
+		}
+		writer, err := oggwriter.NewWith(file, media.OpusSampleRate, 1)
+		if err != nil {
+			file.Close()
+			t.fail(err)
+			return nil
+		}
+		t.writer = writer
+		t.started = time.Now()
+		t.first = packet.Timestamp
+	}
+
+	t.write(t.jitter.Push(packet))
+	return nil
+}
+
+// write adds packets to the file. Lost packets are skipped: the timestamps
+// of the packets around them keep the gap in the file's timeline.
+func (t *Track) write(packets []*rtp.Packet) {
+	for _, p := range packets {
+		if p == nil || len(p.Payload) == 0 {
+			continue
+		}
+		if err := t.writer.WriteRTP(p); err != nil {
+			t.fail(err)
+			return
+		}
+		t.last = p.Timestamp
+		t.packets++
+	}
+}
+
+func (t *Track) fail(err error) {
+	log.Printf("Recording of %s %s stopped: %v", t.speaker, t.participantID, err)
+	t.failed = true
+}
+
+func (t *Track) close(callStart time.Time) TrackInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	info := TrackInfo{
+		ParticipantID: t.participantID,
+		Speaker:       t.speaker,
+	}
+	if t.writer == nil {
+		return info
+	}
+
+	if !t.failed {
+		t.write(t.jitter.Flush())
+	}
+	if err := t.writer.Close(); err != nil {
+		log.Printf("Recording of %s %s not finalized: %v", t.speaker, t.participantID, err)
+	}
+
+	started := t.started
+	info.File = t.file
+	info.StartedAt = &started
+	info.OffsetMs = started.Sub(callStart).Milliseconds()
+	info.Packets = t.packets
+	if t.packets > 0 {
+		samples := int64(t.last-t.first) + int64(media.SamplesPerFrame(media.OpusSampleRate))
+		info.DurationMs = samples * 1000 / media.OpusSampleRate
+	}
+	return info
+}
@@ -0,0 +1,197 @@
+package recording_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"voice-agent/fake"
+	"voice-agent/media"
+	"voice-agent/recording"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4/pkg/media/oggreader"
+)
+
+// packets encodes a tone as 20 ms RTP packets starting at timestamp.
+func packets(t *testing.T, duration time.Duration, sequence uint16, timestamp uint32) []*rtp.Packet {
+	t.Helper()
+
+	encoder, err := fake.NewEncoder(media.OpusSampleRate, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcm := fake.Tone(300, 0.3, duration, media.OpusSampleRate)
+	frame := media.SamplesPerFrame(media.OpusSampleRate)
+	buf := make([]byte, 1500)
+
+	var out []*rtp.Packet
+	for i := 0; i+frame <= len(pcm); i += frame {
+		n, err := encoder.Encode(pcm[i:i+frame], buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, &rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 111, SequenceNumber: sequence, Timestamp: timestamp},
+			Payload: append([]byte(nil), buf[:n]...),
+		})
+		sequence++
+		timestamp += uint32(frame)
+	}
+	return out
+}
+
+func TestRecorder(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := recording.New(dir, "room-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.EnableMix(fake.NewDecoder)
+
+	user := recorder.Track("caller-1", recording.User)
+	agent := recorder.Track("agent-1", recording.Agent)
+	recorder.Track("observer-1", recording.User)
+
+	// The caller's packets arrive with two swapped and one lost near the
+	// end, so the jitter buffer is still waiting for it at Close. The agent
+	// starts later and pauses between two utterances.
+	userPackets := packets(t, time.Second, 100, 5000)
+	userPackets[10], userPackets[11] = userPackets[11], userPackets[10]
+	userPackets = append(userPackets[:47], userPackets[48:]...)
+	for _, p := range userPackets {
+		user.WriteRTP(p)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for _, p := range packets(t, 200*time.Millisecond, 0, 0) {
+		agent.WriteRTP(p)
+	}
+	for _, p := range packets(t, 200*time.Millisecond, 10, 48000) {
+		agent.WriteRTP(p)
+	}
+
+	manifest, err := recorder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.WriteRTP(packets(t, 20*time.Millisecond, 200, 100000)[0])
+
+	data, err := os.ReadFile(filepath.Join(recorder.Dir(), recording.ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved recording.Manifest
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.RoomID != "room-1" || len(saved.Tracks) != 3 || saved.Mix != recording.MixFile {
+		t.Fatalf("manifest = %s", data)
+	}
+	if manifest.Tracks[0].ParticipantID != "caller-1" || manifest.Tracks[1].Speaker != recording.Agent {
+		t.Errorf("tracks = %+v", manifest.Tracks)
+	}
+	if track := saved.Tracks[2]; track.File != "" || track.StartedAt != nil {
+		t.Errorf("track without audio = %+v", track)
+	}
+
+	// Every packet before Close is in the file, in order, and a lost one
+	// leaves a gap.
+	userTrack := saved.Tracks[0]
+	if userTrack.Packets != 49 {
+		t.Errorf("user packets = %d", userTrack.Packets)
+	}
+	if agentTrack := saved.Tracks[1]; agentTrack.OffsetMs < 50 || agentTrack.DurationMs != 1200 {
+		t.Errorf("agent track = %+v", agentTrack)
+	}
+
+	granules := readGranules(t, filepath.Join(recorder.Dir(), userTrack.File))
+	for i := 1; i < len(granules); i++ {
+		if granules[i] <= granules[i-1] {
+			t.Fatalf("user granules out of order: %v", granules)
+		}
+	}
+	agentGranules := readGranules(t, filepath.Join(recorder.Dir(), saved.Tracks[1].File))
+	if gap := agentGranules[10] - agentGranules[9]; gap != 48000-9*960 {
+		t.Errorf("agent pause = %d samples", gap)
+	}
+
+	// The mix has the user on the left and the agent, after its offset,
+	// on the right, with the agent's pause kept.
+	left, right := readMix(t, filepath.Join(recorder.Dir(), saved.Mix))
+	const rate = 16000
+	if level(left[rate/10:rate/5]) == 0 || level(right[:rate/50]) != 0 {
+		t.Error("mix channels are not lined up")
+	}
+	agentStart := int(saved.Tracks[1].OffsetMs) * rate / 1000
+	if level(right[agentStart+rate/10:agentStart+rate/5]) == 0 {
+		t.Error("agent audio missing from the mix")
+	}
+	if level(right[agentStart+rate/2:agentStart+rate*9/10]) != 0 {
+		t.Error("agent pause missing from the mix")
+	}
+}
+
+func readGranules(t *testing.T, path string) []uint64 {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	reader, _, err := oggreader.NewWith(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var granules []uint64
+	for {
+		_, header, err := reader.ParseNextPage()
+		if errors.Is(err, io.EOF) {
+			return granules
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+		if header.GranulePosition != 0 {
+			granules = append(granules, header.GranulePosition)
+		}
+	}
+}
+
+func readMix(t *testing.T, path string) (left, right []int16) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 44 || binary.LittleEndian.Uint16(data[22:]) != 2 {
+		t.Fatalf("mix is not a stereo WAV file")
+	}
+	for i := 44; i+4 <= len(data); i += 4 {
+		left = append(left, int16(binary.LittleEndian.Uint16(data[i:])))
+		right = append(right, int16(binary.LittleEndian.Uint16(data[i+2:])))
+	}
+	return left, right
+}
+
+// level is the peak absolute sample.
+func level(pcm []int16) int {
+	peak := 0
+	for _, v := range pcm {
+		peak = max(peak, abs(int(v)))
+	}
+	return peak
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
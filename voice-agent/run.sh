@@ -1,2 +1,2 @@
 #!/bin/bash
-cd voice-agent && go run main.go
+cd voice-agent && go run -tags libopus .
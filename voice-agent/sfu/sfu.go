@@ -44,7 +44,10 @@ func (s *SFU) CreatePeerConnection() (*webrtc.PeerConnection, error) {
 		return nil, err
 	}
 
-	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine))
+	settingEngine := webrtc.SettingEngine{}
+	settingEngine.SetIncludeLoopbackCandidate(s.config.ICEIncludeLoopback)
+
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine), webrtc.WithSettingEngine(settingEngine))
 	return api.NewPeerConnection(peerConfig)
 }
 
@@ -61,6 +64,12 @@ func (s *SFU) HandleTrack(track *webrtc.TrackRemote, receiver *webrtc.RTPReceive
 			return
 		}
 
+        for _, sink := range sourceParticipant.GetRTPSinks() {
+            if err := sink.WriteRTP(rtpPacket); err != nil {
+                log.Printf("RTP sink error for participant %s: %v", sourceParticipant.ID, err)
+            }
+        }
+
         participants := room.GetParticipants()
         forwarded := 0
         for _, p := range participants {
@@ -109,10 +118,25 @@ func (s *SFU) SetupParticipantConnection(participant *models.Participant, room *
 		go s.HandleTrack(track, receiver, room, participant)
 	})
 
+	pc.OnICECandidate(participant.AddLocalCandidate)
+	pc.OnICEGatheringStateChange(func(state webrtc.ICEGatheringState) {
+		if state == webrtc.ICEGatheringStateGathering {
+			participant.ResetLocalCandidates()
+		}
+	})
+
+	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
+		log.Printf("Data channel %q opened by participant %s", dc.Label(), participant.ID)
+		participant.SetDataChannel(dc)
+	})
+
     pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
         log.Printf("Participant %s ICE connection state: %s", participant.ID, state.String())
 		
-		if state == webrtc.ICEConnectionStateFailed || state == webrtc.ICEConnectionStateClosed {
+		switch state {
+		case webrtc.ICEConnectionStateDisconnected:
+			participant.ICEDisconnected()
+		case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateClosed:
 			room.RemoveParticipant(participant.ID)
 		}
 	})
@@ -133,19 +157,43 @@ func (s *SFU) CreateOffer(pc *webrtc.PeerConnection) (*webrtc.SessionDescription
 	return &offer, nil
 }
 
-func (s *SFU) CreateAnswer(pc *webrtc.PeerConnection, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
-	if err := pc.SetRemoteDescription(offer); err != nil {
+// CreateRestartOffer creates an offer that restarts ICE on pc with new
+// credentials. It waits for the new candidates so the offer carries them
+// all.
+func (s *SFU) CreateRestartOffer(pc *webrtc.PeerConnection) (*webrtc.SessionDescription, error) {
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
 		return nil, err
 	}
 
-    // Create the answer
-    answer, err := pc.CreateAnswer(nil)
+	// Creating the offer restarted gathering, so this waits for the new
+	// candidates rather than the ones already gathered.
+	gatherComplete := webrtc.GatheringCompletePromise(pc)
+	if err = pc.SetLocalDescription(offer); err != nil {
+		return nil, err
+	}
+	<-gatherComplete
+
+	return pc.LocalDescription(), nil
+}
+
+// CreateTrickleRestartOffer is CreateRestartOffer without waiting for ICE
+// gathering. The offer carries no candidates; they are reported through the
+// participant's LocalCandidates as they are gathered.
+func (s *SFU) CreateTrickleRestartOffer(pc *webrtc.PeerConnection) (*webrtc.SessionDescription, error) {
+	offer, err := pc.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
 	if err != nil {
 		return nil, err
 	}
 
-    // Set local description to start ICE gathering
-    if err = pc.SetLocalDescription(answer); err != nil {
+	if err = pc.SetLocalDescription(offer); err != nil {
+		return nil, err
+	}
+	return pc.LocalDescription(), nil
+}
+
+func (s *SFU) CreateAnswer(pc *webrtc.PeerConnection, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if err := s.answer(pc, offer); err != nil {
 		return nil, err
 	}
 
@@ -157,6 +205,31 @@ func (s *SFU) CreateAnswer(pc *webrtc.PeerConnection, offer webrtc.SessionDescri
     return local, nil
 }
 
+// CreateTrickleAnswer answers offer without waiting for ICE gathering. The
+// answer carries no candidates; they are reported through the
+// participant's LocalCandidates as they are gathered.
+func (s *SFU) CreateTrickleAnswer(pc *webrtc.PeerConnection, offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if err := s.answer(pc, offer); err != nil {
+		return nil, err
+	}
+	return pc.LocalDescription(), nil
+}
+
+func (s *SFU) answer(pc *webrtc.PeerConnection, offer webrtc.SessionDescription) error {
+	if err := pc.SetRemoteDescription(offer); err != nil {
+		return err
+	}
+
+    // Create the answer
+    answer, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return err
+	}
+
+    // Set local description to start ICE gathering
+	return pc.SetLocalDescription(answer)
+}
+
 func (s *SFU) AddICECandidate(pc *webrtc.PeerConnection, candidate webrtc.ICECandidateInit) error {
 	return pc.AddICECandidate(candidate)
 }
@@ -0,0 +1,281 @@
+package signaling
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"voice-agent/models"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Message types. A client connects to its room, may join it to learn how
+// the call is set up, then negotiates its peer connection with offer,
+// answer and candidate messages, and ends the call with leave. The server
+// answers offers, sends an offer of its own to restart ICE when the
+// connection drops, and reports the agent's state, the end of the call and
+// any failed request.
+//
+// Unless trickle ICE is turned off, the server's answers and offers carry
+// no candidates: they follow as candidate messages, the last of which has
+// an empty candidate string. Every answer and offer is followed by its own
+// candidates.
+const (
+	TypeJoin       = "join"
+	TypeJoined     = "joined"
+	TypeOffer      = "offer"
+	TypeAnswer     = "answer"
+	TypeCandidate  = "candidate"
+	TypeLeave      = "leave"
+	TypeHangup     = "hangup"
+	TypeAgentState = "agent_state"
+	TypeError      = "error"
+)
+
+// JoinedData is the data of a joined message. AgentState is empty until
+// the agent has started.
+type JoinedData struct {
+	ICETrickle bool   `json:"ice_trickle"`
+	AgentState string `json:"agent_state,omitempty"`
+}
+
+// AgentStateData is the data of an agent_state message.
+type AgentStateData struct {
+	State string `json:"state"`
+}
+
+// HangupData is the data of a hangup message.
+type HangupData struct {
+	Reason string `json:"reason"`
+}
+
+func (s *SignalingServer) handleSignalMessage(client *Client, msg *models.SignalMessage) {
+	log.Printf("Received signal from %s: type=%s", client.ID, msg.Type)
+
+	var err error
+	switch msg.Type {
+	case TypeJoin:
+		err = s.join(client, msg)
+	case TypeOffer:
+		err = s.offer(client, msg)
+	case TypeAnswer:
+		err = s.answer(client, msg)
+	case TypeCandidate:
+		err = s.candidate(client, msg)
+	case TypeLeave:
+		err = s.leave(client)
+	default:
+		err = fmt.Errorf("unknown message type %q", msg.Type)
+	}
+
+	if err != nil {
+		log.Printf("Signal %s from %s failed: %v", msg.Type, client.ID, err)
+		client.send(&models.SignalMessage{Type: TypeError, RoomID: msg.RoomID, Error: err.Error()})
+	}
+}
+
+// join confirms the room the client connected to and tells it whether the
+// server trickles its candidates and what the agent is doing. The room ID
+// may be left out.
+func (s *SignalingServer) join(client *Client, msg *models.SignalMessage) error {
+	if msg.RoomID != "" && msg.RoomID != client.RoomID {
+		return fmt.Errorf("connected to room %s, not %s", client.RoomID, msg.RoomID)
+	}
+
+	s.mutex.RLock()
+	state := s.agentStates[client.ID]
+	s.mutex.RUnlock()
+
+	client.send(&models.SignalMessage{Type: TypeJoined, RoomID: client.RoomID, Data: JoinedData{
+		ICETrickle: s.config.ICETrickle,
+		AgentState: state,
+	}})
+	return nil
+}
+
+func (s *SignalingServer) offer(client *Client, msg *models.SignalMessage) error {
+	if msg.SDP == nil || msg.SDP.Type != webrtc.SDPTypeOffer {
+		return errors.New("offer message needs an offer sdp")
+	}
+
+	if !s.config.ICETrickle {
+		answer, err := s.sfu.CreateAnswer(client.Participant.PeerConnection, *msg.SDP)
+		if err != nil {
+			return fmt.Errorf("failed to create answer: %w", err)
+		}
+		client.send(&models.SignalMessage{Type: TypeAnswer, RoomID: client.RoomID, SDP: answer})
+		return nil
+	}
+
+	client.endTrickle()
+	answer, err := s.sfu.CreateTrickleAnswer(client.Participant.PeerConnection, *msg.SDP)
+	if err != nil {
+		return fmt.Errorf("failed to create answer: %w", err)
+	}
+	client.send(&models.SignalMessage{Type: TypeAnswer, RoomID: client.RoomID, SDP: answer})
+
+	// Candidates only go out after the answer, which the client needs
+	// before it can add them.
+	client.trickle()
+	return nil
+}
+
+// trickle sends the client the candidates gathered for the participant's
+// latest local description as they arrive, ending with an empty one once
+// gathering completes. Each negotiation starts its own trickle, after
+// ending the previous one with endTrickle before its local description is
+// set.
+func (c *Client) trickle() {
+	stop := make(chan struct{})
+	c.mutex.Lock()
+	c.stopTrickle = stop
+	c.mutex.Unlock()
+
+	go func() {
+		for n := 0; ; {
+			candidates, done, changed := c.Participant.LocalCandidates(n)
+			n += len(candidates)
+
+			// Sending under the lock keeps an ended trickle from sending
+			// anything after the next local description.
+			c.mutex.Lock()
+			select {
+			case <-stop:
+				c.mutex.Unlock()
+				return
+			default:
+			}
+			for i := range candidates {
+				c.send(&models.SignalMessage{Type: TypeCandidate, RoomID: c.RoomID, Candidate: &candidates[i]})
+			}
+			if done {
+				c.send(&models.SignalMessage{Type: TypeCandidate, RoomID: c.RoomID, Candidate: &webrtc.ICECandidateInit{}})
+			}
+			c.mutex.Unlock()
+			if done {
+				return
+			}
+
+			select {
+			case <-changed:
+			case <-stop:
+				return
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// endTrickle stops the trickle of the client's previous negotiation, if it
+// is still running.
+func (c *Client) endTrickle() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stopTrickle != nil {
+		close(c.stopTrickle)
+		c.stopTrickle = nil
+	}
+}
+
+func (s *SignalingServer) answer(client *Client, msg *models.SignalMessage) error {
+	if msg.SDP == nil || msg.SDP.Type != webrtc.SDPTypeAnswer {
+		return errors.New("answer message needs an answer sdp")
+	}
+
+	if err := client.Participant.PeerConnection.SetRemoteDescription(*msg.SDP); err != nil {
+		return fmt.Errorf("failed to set answer: %w", err)
+	}
+	return nil
+}
+
+func (s *SignalingServer) candidate(client *Client, msg *models.SignalMessage) error {
+	if msg.Candidate == nil {
+		return errors.New("candidate message needs a candidate")
+	}
+
+	if err := s.sfu.AddICECandidate(client.Participant.PeerConnection, *msg.Candidate); err != nil {
+		return fmt.Errorf("failed to add ICE candidate: %w", err)
+	}
+	return nil
+}
+
+// leave ends the call by closing the client's peer connection; the agent
+// hangs up in turn.
+func (s *SignalingServer) leave(client *Client) error {
+	return client.Participant.PeerConnection.Close()
+}
+
+// RestartICE sends the client an offer that restarts ICE on its peer
+// connection. The server's new candidates trickle after it, or are all in
+// it when trickle ICE is turned off. The client replies with an answer
+// message. It is called when a client's connection drops.
+func (s *SignalingServer) RestartICE(clientID string) error {
+	client := s.client(clientID)
+	if client == nil {
+		return fmt.Errorf("client %s not connected", clientID)
+	}
+
+	pc := client.Participant.PeerConnection
+	if state := pc.SignalingState(); state != webrtc.SignalingStateStable {
+		return fmt.Errorf("negotiation in progress (%s)", state)
+	}
+
+	if !s.config.ICETrickle {
+		offer, err := s.sfu.CreateRestartOffer(pc)
+		if err != nil {
+			return err
+		}
+		client.send(&models.SignalMessage{Type: TypeOffer, RoomID: client.RoomID, SDP: offer})
+		return nil
+	}
+
+	client.endTrickle()
+	offer, err := s.sfu.CreateTrickleRestartOffer(pc)
+	if err != nil {
+		return err
+	}
+	client.send(&models.SignalMessage{Type: TypeOffer, RoomID: client.RoomID, SDP: offer})
+	client.trickle()
+	return nil
+}
+
+// Hangup tells the client its call is over and why.
+func (s *SignalingServer) Hangup(clientID, reason string) {
+	s.mutex.Lock()
+	delete(s.agentStates, clientID)
+	s.mutex.Unlock()
+
+	if client := s.client(clientID); client != nil {
+		client.send(&models.SignalMessage{Type: TypeHangup, RoomID: client.RoomID, Data: HangupData{Reason: reason}})
+	}
+}
+
+// SendAgentState tells the client what the agent in its call is doing.
+// A client that connects later learns the last state when it joins.
+func (s *SignalingServer) SendAgentState(clientID, state string) {
+	s.mutex.Lock()
+	s.agentStates[clientID] = state
+	s.mutex.Unlock()
+
+	if client := s.client(clientID); client != nil {
+		client.send(&models.SignalMessage{Type: TypeAgentState, RoomID: client.RoomID, Data: AgentStateData{State: state}})
+	}
+}
+
+func (s *SignalingServer) client(clientID string) *Client {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.clients[clientID]
+}
+
+// send queues a message for the client, dropping it if the client is
+// gone or not keeping up.
+func (c *Client) send(msg *models.SignalMessage) {
+	select {
+	case c.Send <- msg:
+	case <-c.done:
+	default:
+		log.Printf("Signal %s to %s dropped", msg.Type, c.ID)
+	}
+}
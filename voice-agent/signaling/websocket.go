@@ -1,129 +1,185 @@
 package signaling
 
 import (
-        "log"
-        "net/http"
-        "sync"
-        "voice-agent/models"
-
-        "github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"sync"
+	"voice-agent/config"
+	"voice-agent/models"
+	"voice-agent/room"
+	"voice-agent/sfu"
+
+	"github.com/gorilla/websocket"
 )
 
 var upgrader = websocket.Upgrader{
-        CheckOrigin: func(r *http.Request) bool {
-                return true
-        },
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
 }
 
 type SignalingServer struct {
-        clients map[string]*Client
-        mutex   sync.RWMutex
+	config  *config.Config
+	rooms   *room.Manager
+	sfu     *sfu.SFU
+	clients map[string]*Client
+	// agentStates holds the last agent state of each call, by client ID,
+	// for clients that connect after it was sent.
+	agentStates map[string]string
+	mutex       sync.RWMutex
 }
 
+// Client is one signaling connection. Its ID is the session ID of the
+// participant it speaks for, and it belongs to that participant's room for
+// as long as it is connected.
 type Client struct {
-        ID   string
-        Conn *websocket.Conn
-        Send chan *models.SignalMessage
+	ID          string
+	RoomID      string
+	Participant *models.Participant
+	Conn        *websocket.Conn
+	Send        chan *models.SignalMessage
+
+	done  chan struct{}
+	mutex sync.Mutex
+	// stopTrickle ends the trickle of the client's latest negotiation.
+	stopTrickle chan struct{}
 }
 
-func NewSignalingServer() *SignalingServer {
-        return &SignalingServer{
-                clients: make(map[string]*Client),
-        }
+func NewSignalingServer(cfg *config.Config, rooms *room.Manager, sfu *sfu.SFU) *SignalingServer {
+	return &SignalingServer{
+		config:      cfg,
+		rooms:       rooms,
+		sfu:         sfu,
+		clients:     make(map[string]*Client),
+		agentStates: make(map[string]string),
+	}
 }
 
+// HandleWebSocket connects a caller's client, named by the client_id and
+// room_id query parameters. The connection is refused unless the client is
+// a caller in that room.
 func (s *SignalingServer) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
-        conn, err := upgrader.Upgrade(w, r, nil)
-        if err != nil {
-                log.Printf("WebSocket upgrade error: %v", err)
-                return
-        }
-
-        clientID := r.URL.Query().Get("client_id")
-        if clientID == "" {
-                conn.Close()
-                return
-        }
-
-        client := &Client{
-                ID:   clientID,
-                Conn: conn,
-                Send: make(chan *models.SignalMessage, 256),
-        }
-
-        s.mutex.Lock()
-        s.clients[clientID] = client
-        s.mutex.Unlock()
-
-        go s.writePump(client)
-        go s.readPump(client)
+	clientID := r.URL.Query().Get("client_id")
+	roomID := r.URL.Query().Get("room_id")
+	if clientID == "" || roomID == "" {
+		http.Error(w, "client_id and room_id are required", http.StatusBadRequest)
+		return
+	}
+
+	room, exists := s.rooms.GetRoom(roomID)
+	if !exists {
+		http.Error(w, "Room not found", http.StatusNotFound)
+		return
+	}
+	participant, exists := room.GetParticipant(clientID)
+	if !exists || participant.IsAgent {
+		http.Error(w, "Not a participant in this room", http.StatusForbidden)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	client := &Client{
+		ID:          clientID,
+		RoomID:      roomID,
+		Participant: participant,
+		Conn:        conn,
+		Send:        make(chan *models.SignalMessage, 256),
+		done:        make(chan struct{}),
+	}
+
+	s.mutex.Lock()
+	s.clients[clientID] = client
+	s.mutex.Unlock()
+
+	// Restart ICE when the connection drops, before it is given up on.
+	participant.OnICEDisconnected(func() {
+		go func() {
+			if err := s.RestartICE(clientID); err != nil {
+				log.Printf("ICE restart for %s failed: %v", clientID, err)
+			}
+		}()
+	})
+
+	go s.writePump(client)
+	go s.readPump(client)
 }
 
 func (s *SignalingServer) readPump(client *Client) {
-        defer func() {
-                s.mutex.Lock()
-                delete(s.clients, client.ID)
-                s.mutex.Unlock()
-                client.Conn.Close()
-        }()
-
-        for {
-                var msg models.SignalMessage
-                err := client.Conn.ReadJSON(&msg)
-                if err != nil {
-                        if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-                                log.Printf("WebSocket error: %v", err)
-                        }
-                        break
-                }
-
-                s.handleSignalMessage(client, &msg)
-        }
+	defer func() {
+		s.mutex.Lock()
+		// A reconnect under the same ID may already have replaced us.
+		if s.clients[client.ID] == client {
+			delete(s.clients, client.ID)
+		}
+		s.mutex.Unlock()
+		close(client.done)
+		client.Conn.Close()
+	}()
+
+	for {
+		var msg models.SignalMessage
+		err := client.Conn.ReadJSON(&msg)
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			break
+		}
+
+		s.handleSignalMessage(client, &msg)
+	}
 }
 
 func (s *SignalingServer) writePump(client *Client) {
-        defer client.Conn.Close()
-
-        for msg := range client.Send {
-                err := client.Conn.WriteJSON(msg)
-                if err != nil {
-                        log.Printf("Write error: %v", err)
-                        return
-                }
-        }
-}
-
-func (s *SignalingServer) handleSignalMessage(client *Client, msg *models.SignalMessage) {
-        log.Printf("Received signal from %s: type=%s", client.ID, msg.Type)
+	defer client.Conn.Close()
+
+	for {
+		select {
+		case msg := <-client.Send:
+			err := client.Conn.WriteJSON(msg)
+			if err != nil {
+				log.Printf("Write error: %v", err)
+				return
+			}
+		case <-client.done:
+			return
+		}
+	}
 }
 
 func (s *SignalingServer) SendToClient(clientID string, msg *models.SignalMessage) error {
-        s.mutex.RLock()
-        client, exists := s.clients[clientID]
-        s.mutex.RUnlock()
-
-        if !exists {
-                return nil
-        }
-
-        select {
-        case client.Send <- msg:
-                return nil
-        default:
-                return nil
-        }
+	s.mutex.RLock()
+	client, exists := s.clients[clientID]
+	s.mutex.RUnlock()
+
+	if !exists {
+		return nil
+	}
+
+	select {
+	case client.Send <- msg:
+		return nil
+	default:
+		return nil
+	}
 }
 
+// BroadcastToRoom sends msg to every client in the room except excludeID.
 func (s *SignalingServer) BroadcastToRoom(roomID string, msg *models.SignalMessage, excludeID string) {
-        s.mutex.RLock()
-        defer s.mutex.RUnlock()
-
-        for id, client := range s.clients {
-                if id != excludeID {
-                        select {
-                        case client.Send <- msg:
-                        default:
-                        }
-                }
-        }
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for id, client := range s.clients {
+		if client.RoomID == roomID && id != excludeID {
+			select {
+			case client.Send <- msg:
+			default:
+			}
+		}
+	}
 }
@@ -0,0 +1,77 @@
+package stt
+
+import (
+	"strings"
+	"unicode"
+)
+
+// silenceArtifacts are phrases Whisper is known to produce for silence and
+// background noise, normalized as by normalizePhrase.
+var silenceArtifacts = map[string]bool{
+	"you":                                  true,
+	"thank you":                            true,
+	"thanks":                               true,
+	"thanks for watching":                  true,
+	"thank you for watching":               true,
+	"bye":                                  true,
+	"subtitles by the amara org community": true,
+	"please subscribe":                     true,
+	"धन्यवाद":                              true,
+	"शुक्रिया":                             true,
+}
+
+// artifactNoSpeechProb is the no-speech probability above which one of the
+// silenceArtifacts is taken for noise. It is below Whisper's own threshold
+// because the phrase is suspect already, and Whisper is often sure of its
+// words when it invents them.
+const artifactNoSpeechProb = 0.3
+
+// Thresholds decide whether a transcript is clear enough to act on.
+type Thresholds struct {
+	// MinConfidence rejects transcripts whose reported confidence is
+	// lower. Transcripts without a confidence are not judged by it.
+	MinConfidence float64
+	// MinLetters rejects transcripts with fewer letters than this. The
+	// vowel signs and other marks of scripts such as Devanagari count as
+	// letters, so a short Hindi reply like "हाँ" is not too short.
+	MinLetters int
+}
+
+// Unclear returns why t should not be acted on, or "" if it is clear. A
+// phrase Whisper invents for silence is unclear unless the transcriber's
+// segments say the audio most likely held speech.
+func (th Thresholds) Unclear(t *Transcript) string {
+	letters := 0
+	for _, r := range t.Text {
+		if isLetter(r) {
+			letters++
+		}
+	}
+	if letters < th.MinLetters {
+		return "too short"
+	}
+
+	confidence, ok := t.Confidence()
+	if ok && confidence < th.MinConfidence {
+		return "low confidence"
+	}
+	if silenceArtifacts[normalizePhrase(t.Text)] {
+		if noSpeech, ok := t.NoSpeechProb(); !ok || noSpeech > artifactNoSpeechProb {
+			return "likely noise"
+		}
+	}
+	return ""
+}
+
+// normalizePhrase lowercases text and reduces punctuation to single spaces.
+func normalizePhrase(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// isLetter reports whether r is a letter or a combining mark, which is part
+// of the letter before it.
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsMark(r)
+}
@@ -0,0 +1,53 @@
+package stt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThresholdsUnclear(t *testing.T) {
+	th := Thresholds{MinConfidence: 0.45, MinLetters: 2}
+	segment := func(logprob, noSpeech float64) []Segment {
+		return []Segment{{Start: 0, End: time.Second, AvgLogprob: logprob, NoSpeechProb: noSpeech}}
+	}
+
+	tests := []struct {
+		transcript Transcript
+		want       string
+	}{
+		{Transcript{Text: "What is my premium?"}, ""},
+		{Transcript{Text: "A."}, "too short"},
+		{Transcript{Text: "Thank you."}, "likely noise"},
+		{Transcript{Text: "Thanks for watching!"}, "likely noise"},
+		// Whisper is often confident of a phrase it invents for silence;
+		// the segment's no-speech probability gives it away.
+		{Transcript{Text: "Thank you.", Segments: segment(-0.1, 0.02)}, ""},
+		{Transcript{Text: "Thank you.", Segments: segment(-0.1, 0.55)}, "likely noise"},
+		{Transcript{Text: "धन्यवाद।", Segments: segment(-0.2, 0.7)}, "likely noise"},
+		{Transcript{Text: "धन्यवाद।", Segments: segment(-0.2, 0.05)}, ""},
+		{Transcript{Text: "What is my premium?", Segments: segment(-0.2, 0.5)}, ""},
+		{Transcript{Text: "Is my policy active?", Segments: segment(-1.2, 0.1)}, "low confidence"},
+		// Devanagari vowel signs and the chandrabindu are marks, not
+		// letters, but count as letters here.
+		{Transcript{Text: "हाँ।"}, ""},
+		{Transcript{Text: "जी"}, ""},
+		{Transcript{Text: "ह।"}, "too short"},
+	}
+	for _, test := range tests {
+		if got := th.Unclear(&test.transcript); got != test.want {
+			t.Errorf("Unclear(%q) = %q, want %q", test.transcript.Text, got, test.want)
+		}
+	}
+}
+
+func TestNormalizePhrase(t *testing.T) {
+	for text, want := range map[string]string{
+		"Thanks for watching!": "thanks for watching",
+		"  Bye... bye ":        "bye bye",
+		"धन्यवाद, हाँ।":        "धन्यवाद हाँ",
+	} {
+		if got := normalizePhrase(text); got != want {
+			t.Errorf("normalizePhrase(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
@@ -2,16 +2,28 @@ package stt
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"time"
+	"voice-agent/config"
 )
 
+const openAIBaseURL = "https://api.openai.com/v1"
+
+func init() {
+	Register("openai", func(cfg *config.Config) (Transcriber, error) {
+		return NewOpenAISTT(cfg.OpenAIKey), nil
+	})
+}
+
 type OpenAISTT struct {
-	apiKey string
-	client *http.Client
+	apiKey  string
+	baseURL string
+	client  *http.Client
 }
 
 type TranscriptionRequest struct {
@@ -23,124 +35,149 @@ type TranscriptionResponse struct {
 	Text string `json:"text"`
 }
 
+// VerboseTranscriptionResponse is Whisper's verbose_json output. Times are
+// in seconds.
+type VerboseTranscriptionResponse struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Segments []struct {
+		Text         string  `json:"text"`
+		Start        float64 `json:"start"`
+		End          float64 `json:"end"`
+		AvgLogprob   float64 `json:"avg_logprob"`
+		NoSpeechProb float64 `json:"no_speech_prob"`
+	} `json:"segments"`
+	Words []struct {
+		Word  string  `json:"word"`
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+	} `json:"words"`
+}
+
 func NewOpenAISTT(apiKey string) *OpenAISTT {
 	return &OpenAISTT{
-		apiKey: apiKey,
-		client: &http.Client{},
+		apiKey:  apiKey,
+		baseURL: openAIBaseURL,
+		client:  &http.Client{},
 	}
 }
 
 func (o *OpenAISTT) TranscribeAudio(audioData []byte, language string) (string, error) {
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-
-	part, err := writer.CreateFormFile("file", "audio.webm")
-	if err != nil {
-		return "", err
-	}
-
-	if _, err = part.Write(audioData); err != nil {
-		return "", err
-	}
+	return o.Transcribe(context.Background(), audioData, "audio.webm", Options{Language: language})
+}
 
-	if err = writer.WriteField("model", "whisper-1"); err != nil {
+// Transcribe transcribes audio in any container Whisper accepts; the
+// extension of filename tells the API which format to expect. The prompt
+// goes in Whisper's prompt field.
+func (o *OpenAISTT) Transcribe(ctx context.Context, audioData []byte, filename string, opts Options) (string, error) {
+	var result TranscriptionResponse
+	if err := o.transcribe(ctx, audioData, filename, opts, nil, &result); err != nil {
 		return "", err
 	}
+	return result.Text, nil
+}
 
-	if language != "" {
-		if err = writer.WriteField("language", language); err != nil {
-			return "", err
-		}
-	}
+// TranscribeDetailed requests verbose_json with segment and word
+// timestamps, for aligning transcripts with recordings and for telling
+// speech from text Whisper produced for silence.
+func (o *OpenAISTT) TranscribeDetailed(ctx context.Context, audioData []byte, filename string, opts Options) (*Transcript, error) {
+	fields := [][2]string{
+		{"response_format", "verbose_json"},
+		{"timestamp_granularities[]", "segment"},
+		{"timestamp_granularities[]", "word"},
+	}
+
+	var result VerboseTranscriptionResponse
+	if err := o.transcribe(ctx, audioData, filename, opts, fields, &result); err != nil {
+		return nil, err
+	}
+
+	transcript := &Transcript{
+		Text:     result.Text,
+		Language: result.Language,
+		Duration: seconds(result.Duration),
+	}
+	for _, segment := range result.Segments {
+		transcript.Segments = append(transcript.Segments, Segment{
+			Text:         segment.Text,
+			Start:        seconds(segment.Start),
+			End:          seconds(segment.End),
+			AvgLogprob:   segment.AvgLogprob,
+			NoSpeechProb: segment.NoSpeechProb,
+		})
+	}
+	for _, word := range result.Words {
+		transcript.Words = append(transcript.Words, Word{
+			Word:  word.Word,
+			Start: seconds(word.Start),
+			End:   seconds(word.End),
+		})
+	}
+	return transcript, nil
+}
 
-	writer.Close()
+// transcribe posts the audio with the given extra form fields and decodes
+// the response into result.
+func (o *OpenAISTT) transcribe(ctx context.Context, audioData []byte, filename string, opts Options, fields [][2]string, result interface{}) error {
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/audio/transcriptions", &requestBody)
+	part, err := writer.CreateFormFile("file", filename)
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.apiKey))
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	resp, err := o.client.Do(req)
-	if err != nil {
-		return "", err
+	if _, err = part.Write(audioData); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("OpenAI API error: %s", string(body))
+	if err = writer.WriteField("model", "whisper-1"); err != nil {
+		return err
 	}
 
-	var result TranscriptionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+	if opts.Language != "" {
+		if err = writer.WriteField("language", opts.Language); err != nil {
+			return err
+		}
 	}
 
-	return result.Text, nil
-}
-
-type ChatCompletionRequest struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
-}
-
-type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
-}
-
-type ChatCompletionResponse struct {
-	Choices []struct {
-		Message Message `json:"message"`
-	} `json:"choices"`
-}
-
-func (o *OpenAISTT) GetChatCompletion(messages []Message, systemPrompt string) (string, error) {
-	allMessages := []Message{
-		{Role: "system", Content: systemPrompt},
+	if opts.Prompt != "" {
+		if err = writer.WriteField("prompt", opts.Prompt); err != nil {
+			return err
+		}
 	}
-	allMessages = append(allMessages, messages...)
 
-	payload := ChatCompletionRequest{
-		Model:    "gpt-4",
-		Messages: allMessages,
+	for _, field := range fields {
+		if err = writer.WriteField(field[0], field[1]); err != nil {
+			return err
+		}
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return "", err
-	}
+	writer.Close()
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/audio/transcriptions", &requestBody)
 	if err != nil {
-		return "", err
+		return err
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", o.apiKey))
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	resp, err := o.client.Do(req)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("OpenAI API error: %s", string(body))
-	}
-
-	var result ChatCompletionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return fmt.Errorf("OpenAI API error: %s", string(body))
 	}
 
-	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("no response from OpenAI")
-	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
 
-	return result.Choices[0].Message.Content, nil
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
 }
@@ -0,0 +1,101 @@
+package stt
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// verboseResponse is a transcription of a short utterance followed by
+// background noise that Whisper turned into a sign-off.
+const verboseResponse = `{
+	"task": "transcribe",
+	"language": "english",
+	"duration": 4.2,
+	"text": "What is my premium? Thanks for watching!",
+	"segments": [
+		{"id": 0, "start": 0.3, "end": 1.9, "text": " What is my premium?", "avg_logprob": -0.2, "no_speech_prob": 0.01},
+		{"id": 1, "start": 2.5, "end": 4.2, "text": " Thanks for watching!", "avg_logprob": -1.4, "no_speech_prob": 0.82}
+	],
+	"words": [
+		{"word": "What", "start": 0.3, "end": 0.5},
+		{"word": "is", "start": 0.5, "end": 0.6},
+		{"word": "my", "start": 0.6, "end": 0.8},
+		{"word": "premium", "start": 0.8, "end": 1.9},
+		{"word": "Thanks", "start": 2.5, "end": 2.9},
+		{"word": "for", "start": 2.9, "end": 3.1},
+		{"word": "watching", "start": 3.1, "end": 4.2}
+	]
+}`
+
+func TestTranscribeDetailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		if got := r.FormValue("prompt"); got != "Care Shield, NCB Super." {
+			t.Errorf("prompt = %q", got)
+		}
+		if got := r.FormValue("response_format"); got != "verbose_json" {
+			t.Errorf("response_format = %q", got)
+		}
+		if got := r.MultipartForm.Value["timestamp_granularities[]"]; len(got) != 2 {
+			t.Errorf("timestamp_granularities[] = %v, want segment and word", got)
+		}
+		w.Write([]byte(verboseResponse))
+	}))
+	defer server.Close()
+
+	client := NewOpenAISTT("test-key")
+	client.baseURL = server.URL
+
+	transcript, err := TranscribeDetailed(context.Background(), client, []byte("audio"), "audio.wav", Options{Language: "en", Prompt: "Care Shield, NCB Super."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transcript.Language != "english" || len(transcript.Segments) != 2 || len(transcript.Words) != 7 {
+		t.Fatalf("transcript = %+v", transcript)
+	}
+	if transcript.Duration != 4200*time.Millisecond {
+		t.Errorf("Duration = %v", transcript.Duration)
+	}
+
+	speech := transcript.Speech()
+	if speech.Text != "What is my premium?" {
+		t.Errorf("speech text = %q", speech.Text)
+	}
+	if len(speech.Words) != 4 {
+		t.Errorf("speech kept %d words, want 4", len(speech.Words))
+	}
+	if start, end, ok := speech.Span(); !ok || start != 300*time.Millisecond || end != 1900*time.Millisecond {
+		t.Errorf("Span() = %v, %v, %v", start, end, ok)
+	}
+	if confidence, ok := speech.Confidence(); !ok || math.Abs(confidence-math.Exp(-0.2)) > 1e-9 {
+		t.Errorf("Confidence() = %v, %v", confidence, ok)
+	}
+}
+
+type plainTranscriber struct{}
+
+func (plainTranscriber) Transcribe(ctx context.Context, audioData []byte, filename string, opts Options) (string, error) {
+	return "hello", nil
+}
+
+func TestTranscribeDetailedFallback(t *testing.T) {
+	transcript, err := TranscribeDetailed(context.Background(), plainTranscriber{}, nil, "audio.wav", Options{Language: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transcript.Speech().Text != "hello" {
+		t.Errorf("text = %q", transcript.Text)
+	}
+	if _, _, ok := transcript.Span(); ok {
+		t.Error("plain transcript reported timings")
+	}
+	if _, ok := transcript.Confidence(); ok {
+		t.Error("plain transcript reported a confidence")
+	}
+}
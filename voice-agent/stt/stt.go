@@ -0,0 +1,66 @@
+// Package stt turns caller audio into text.
+package stt
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"voice-agent/config"
+)
+
+// Transcriber converts one recorded utterance to text. The extension of
+// filename names the audio container ("audio.webm", "audio.wav").
+type Transcriber interface {
+	Transcribe(ctx context.Context, audioData []byte, filename string, opts Options) (string, error)
+}
+
+// Options are hints for one transcription. Zero fields are left out.
+type Options struct {
+	// Language is an ISO-639-1 code.
+	Language string
+	// Prompt primes the recognizer with the words it should expect,
+	// usually a Vocabulary prompt.
+	Prompt string
+}
+
+// Factory creates a transcriber from the service configuration.
+type Factory func(cfg *config.Config) (Transcriber, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a transcriber available under name. Vendors register
+// themselves from init, so adding one needs no changes elsewhere.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// New creates the transcriber registered under name.
+func New(name string, cfg *config.Config) (Transcriber, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown STT provider %q (have %v)", name, Names())
+	}
+	return factory(cfg)
+}
+
+// Names lists the registered providers.
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,139 @@
+package stt
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+)
+
+// Whisper's own thresholds for deciding that a segment it transcribed was
+// really silence: it is confident there was no speech and unsure of the
+// words it produced anyway.
+const (
+	noSpeechThreshold = 0.6
+	logprobThreshold  = -1.0
+)
+
+// Transcript is a transcription with timing and confidence. Times are
+// offsets into the transcribed audio.
+type Transcript struct {
+	Text     string
+	Language string
+	Duration time.Duration
+	Segments []Segment
+	Words    []Word
+}
+
+type Segment struct {
+	Text  string
+	Start time.Duration
+	End   time.Duration
+	// AvgLogprob is the mean log probability of the segment's tokens.
+	AvgLogprob float64
+	// NoSpeechProb is the model's estimate that the segment held no speech.
+	NoSpeechProb float64
+}
+
+type Word struct {
+	Word  string
+	Start time.Duration
+	End   time.Duration
+}
+
+// DetailedTranscriber is implemented by transcribers that can report
+// segments, word timings and confidence as well as the text.
+type DetailedTranscriber interface {
+	Transcriber
+	TranscribeDetailed(ctx context.Context, audioData []byte, filename string, opts Options) (*Transcript, error)
+}
+
+// TranscribeDetailed asks t for a detailed transcript, falling back to a
+// transcript with only the text when t cannot provide one.
+func TranscribeDetailed(ctx context.Context, t Transcriber, audioData []byte, filename string, opts Options) (*Transcript, error) {
+	if detailed, ok := t.(DetailedTranscriber); ok {
+		return detailed.TranscribeDetailed(ctx, audioData, filename, opts)
+	}
+
+	text, err := t.Transcribe(ctx, audioData, filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Transcript{Text: text, Language: opts.Language}, nil
+}
+
+// silent reports whether the segment is text Whisper made up for silence.
+func (s Segment) silent() bool {
+	return s.NoSpeechProb > noSpeechThreshold && s.AvgLogprob < logprobThreshold
+}
+
+// Speech returns the transcript without segments that were silence, with
+// the text and words rebuilt from what is left. A transcript without
+// segments is returned as is.
+func (t *Transcript) Speech() *Transcript {
+	if len(t.Segments) == 0 {
+		return t
+	}
+
+	speech := &Transcript{Language: t.Language, Duration: t.Duration}
+	var text []string
+	for _, segment := range t.Segments {
+		if segment.silent() {
+			continue
+		}
+		speech.Segments = append(speech.Segments, segment)
+		text = append(text, strings.TrimSpace(segment.Text))
+	}
+	speech.Text = strings.Join(text, " ")
+
+	for _, word := range t.Words {
+		for _, segment := range speech.Segments {
+			if word.Start >= segment.Start && word.Start < segment.End {
+				speech.Words = append(speech.Words, word)
+				break
+			}
+		}
+	}
+	return speech
+}
+
+// Span returns when speech starts and ends in the audio, from the words if
+// there are any and otherwise the segments. ok is false when the
+// transcript carries no timing.
+func (t *Transcript) Span() (start, end time.Duration, ok bool) {
+	switch {
+	case len(t.Words) > 0:
+		return t.Words[0].Start, t.Words[len(t.Words)-1].End, true
+	case len(t.Segments) > 0:
+		return t.Segments[0].Start, t.Segments[len(t.Segments)-1].End, true
+	}
+	return 0, 0, false
+}
+
+// Confidence returns a score from 0 to 1: the probability per token implied
+// by the segments' average log probabilities, weighted by segment length.
+// ok is false when the transcript has no segments to judge by.
+func (t *Transcript) Confidence() (confidence float64, ok bool) {
+	var sum, weight float64
+	for _, segment := range t.Segments {
+		w := (segment.End - segment.Start).Seconds()
+		if w <= 0 {
+			w = 1e-3
+		}
+		sum += segment.AvgLogprob * w
+		weight += w
+	}
+	if weight == 0 {
+		return 0, false
+	}
+	return math.Min(1, math.Exp(sum/weight)), true
+}
+
+// NoSpeechProb returns the highest chance the model gave any segment of
+// holding no speech. ok is false when the transcript has no segments.
+func (t *Transcript) NoSpeechProb() (prob float64, ok bool) {
+	for _, segment := range t.Segments {
+		prob = math.Max(prob, segment.NoSpeechProb)
+	}
+	return prob, len(t.Segments) > 0
+}
@@ -0,0 +1,212 @@
+package stt
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxPromptChars keeps a vocabulary prompt inside the 224 tokens Whisper
+// reads; terms beyond it are dropped from the end.
+const maxPromptChars = 800
+
+// domainAcronyms are abbreviations callers say letter by letter. Only
+// those that appear in the policy documents are added to a vocabulary.
+var domainAcronyms = []string{"UIN", "NCB", "TPA", "AYUSH", "IRDAI", "ICU", "OPD", "PED", "GST", "KYC"}
+
+// Vocabulary is the list of product names and terms the transcriber should
+// expect. Terms earlier in the list take priority when the prompt has to
+// be cut short. The zero value and nil are empty vocabularies.
+type Vocabulary struct {
+	terms []string
+}
+
+// hyphenSpacing matches the spacing around a hyphen, which varies between
+// documents ("No Claim Bonus - SUPER", "No Claim Bonus-Super").
+var hyphenSpacing = regexp.MustCompile(`\s*-\s*`)
+
+// NewVocabulary returns a vocabulary of terms, without duplicates.
+func NewVocabulary(terms ...string) *Vocabulary {
+	return (&Vocabulary{}).With(terms...)
+}
+
+// With returns a copy of v extended with terms, for instance a session's
+// own names. The added terms come first, so they survive truncation.
+func (v *Vocabulary) With(terms ...string) *Vocabulary {
+	extended := &Vocabulary{}
+	seen := make(map[string]bool)
+	for _, term := range append(append([]string(nil), terms...), v.Terms()...) {
+		term = strings.TrimSpace(term)
+		key := strings.ToLower(hyphenSpacing.ReplaceAllString(term, "-"))
+		if term == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		extended.terms = append(extended.terms, term)
+	}
+	return extended
+}
+
+// Terms returns the vocabulary in priority order.
+func (v *Vocabulary) Terms() []string {
+	if v == nil {
+		return nil
+	}
+	return append([]string(nil), v.terms...)
+}
+
+// Prompt renders the vocabulary as a transcription prompt: the terms,
+// comma separated, as Whisper would have written them.
+func (v *Vocabulary) Prompt() string {
+	var prompt strings.Builder
+	for _, term := range v.Terms() {
+		if prompt.Len()+len(term)+3 > maxPromptChars {
+			break
+		}
+		if prompt.Len() > 0 {
+			prompt.WriteString(", ")
+		}
+		prompt.WriteString(term)
+	}
+	if prompt.Len() > 0 {
+		prompt.WriteString(".")
+	}
+	return prompt.String()
+}
+
+// vocabularyPolicy is the part of a purchase_policies.json entry that
+// names products, add-ons and benefits.
+type vocabularyPolicy struct {
+	Summary struct {
+		Name     string `json:"name"`
+		Provider string `json:"provider"`
+	} `json:"policy_summary"`
+	Premium struct {
+		Breakdown map[string]string `json:"breakdown"`
+	} `json:"premium"`
+	Benefits struct {
+		AddOns []struct {
+			Name     string            `json:"name"`
+			Benefits map[string]string `json:"benefits"`
+		} `json:"add_ons"`
+	} `json:"benefits"`
+}
+
+// LoadVocabulary builds a vocabulary from the purchased policies file and a
+// directory of policy wordings in Markdown, named like
+// "<UIN>_care-shield-policy.md". Either path may be empty.
+func LoadVocabulary(policiesPath, docsDir string) (*Vocabulary, error) {
+	var terms []string
+
+	if policiesPath != "" {
+		data, err := os.ReadFile(policiesPath)
+		if err != nil {
+			return nil, err
+		}
+
+		var policies map[string]vocabularyPolicy
+		if err := json.Unmarshal(data, &policies); err != nil {
+			return nil, fmt.Errorf("invalid policies file %s: %w", policiesPath, err)
+		}
+
+		// Products and add-ons first, then the names of premium lines and
+		// add-on benefits, which are how callers refer to them.
+		var products, components []string
+		for _, policy := range policies {
+			products = append(products, titleCase(policy.Summary.Name), parenthetical.ReplaceAllString(policy.Summary.Provider, ""))
+			for _, addOn := range policy.Benefits.AddOns {
+				products = append(products, addOn.Name)
+				for key := range addOn.Benefits {
+					components = append(components, keyToTerm(key))
+				}
+			}
+			for key := range policy.Premium.Breakdown {
+				components = append(components, keyToTerm(key))
+			}
+		}
+		terms = append(terms, sortedUnique(products)...)
+		terms = append(terms, sortedUnique(components)...)
+	}
+
+	if docsDir != "" {
+		docTerms, err := documentTerms(docsDir)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, docTerms...)
+	}
+
+	return NewVocabulary(terms...), nil
+}
+
+var parenthetical = regexp.MustCompile(`\s*\(.*\)`)
+
+var uinPrefix = regexp.MustCompile(`^[A-Z0-9]+_`)
+
+// documentTerms returns the product names in the wording file names and
+// the domain acronyms used in the wordings.
+func documentTerms(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+
+	var products []string
+	var text strings.Builder
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".md")
+		name = strings.TrimSuffix(uinPrefix.ReplaceAllString(name, ""), "-policy")
+		products = append(products, titleCase(strings.ReplaceAll(name, "-", " ")))
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text.Write(data)
+		text.WriteByte('\n')
+	}
+
+	terms := sortedUnique(products)
+	for _, acronym := range domainAcronyms {
+		if regexp.MustCompile(`\b` + acronym + `\b`).MatchString(text.String()) {
+			terms = append(terms, acronym)
+		}
+	}
+	return terms, nil
+}
+
+// keyToTerm turns a JSON key such as "ncb_super" into "NCB Super".
+func keyToTerm(key string) string {
+	return titleCase(strings.ReplaceAll(key, "_", " "))
+}
+
+// titleCase capitalizes each word of s, writing words without vowels, which
+// are abbreviations like "ncb", in capitals.
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		if !strings.ContainsAny(word, "aeiouy") {
+			words[i] = strings.ToUpper(word)
+			continue
+		}
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func sortedUnique(terms []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			unique = append(unique, term)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
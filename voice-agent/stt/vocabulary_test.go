@@ -0,0 +1,72 @@
+package stt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const vocabularyPolicies = `{
+	"1": {
+		"policy_summary": {"name": "CARE ADVANTAGE", "provider": "Care Health Insurance Limited (Formerly Religare)"},
+		"premium": {"breakdown": {"ncb_super": "Rs. 621.43", "gst": "Rs. 1,310.40"}},
+		"benefits": {"add_ons": [
+			{"name": "Care Shield", "benefits": {"inflation_shield": "Applicable"}},
+			{"name": "No Claim Bonus - SUPER"}
+		]}
+	},
+	"2": {
+		"policy_summary": {"name": "CARE", "provider": "Care Health Insurance Limited"},
+		"benefits": {"add_ons": [{"name": "No Claim Bonus-Super"}]}
+	}
+}`
+
+func TestLoadVocabulary(t *testing.T) {
+	dir := t.TempDir()
+	policies := filepath.Join(dir, "purchase_policies.json")
+	if err := os.WriteFile(policies, []byte(vocabularyPolicies), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	docs := filepath.Join(dir, "pdf_md")
+	os.Mkdir(docs, 0o755)
+	wording := "Every policy has a UIN. Claims go through the TPA, not the ICUs."
+	if err := os.WriteFile(filepath.Join(docs, "CHIHLIA26054V022526_care-shield-policy.md"), []byte(wording), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	vocabulary, err := LoadVocabulary(policies, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Care, Care Advantage, Care Health Insurance Limited, Care Shield, No Claim Bonus - SUPER, GST, Inflation Shield, NCB Super, UIN, TPA."
+	if got := vocabulary.Prompt(); got != want {
+		t.Errorf("Prompt() =\n%q\nwant\n%q", got, want)
+	}
+
+	session := vocabulary.With("Zinal Bhogar", "care shield")
+	if got := session.Terms(); got[0] != "Zinal Bhogar" || got[1] != "care shield" || len(got) != len(vocabulary.Terms())+1 {
+		t.Errorf("session terms = %v", got)
+	}
+	if len(vocabulary.Terms()) != 10 {
+		t.Errorf("With changed the shared vocabulary: %v", vocabulary.Terms())
+	}
+}
+
+func TestVocabularyPromptLimit(t *testing.T) {
+	var terms []string
+	for i := 0; i < 200; i++ {
+		terms = append(terms, strings.Repeat(string(rune('a'+i%26)), 5+i%7)+string(rune('A'+i/26)))
+	}
+
+	prompt := NewVocabulary(terms...).Prompt()
+	if len(prompt) > maxPromptChars || !strings.HasPrefix(prompt, terms[0]+", ") || !strings.HasSuffix(prompt, ".") {
+		t.Errorf("prompt of %d chars: %q", len(prompt), prompt)
+	}
+
+	var empty *Vocabulary
+	if empty.Prompt() != "" || empty.With("UIN").Prompt() != "UIN." {
+		t.Error("nil vocabulary is not empty")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"voice-agent/media"
+	"voice-agent/models"
+	"voice-agent/stt"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sttBatchBytes is how much recorded media makes up an utterance for
+	// the HTTP endpoint, whose clients cannot be told about partial results.
+	sttBatchBytes = 60000
+
+	// sttPartialBytes is how much new media triggers another partial
+	// hypothesis for the utterance in progress.
+	sttPartialBytes = 16000
+
+	// sttEndSilence is how long the recording must run on after the last
+	// speech in a partial hypothesis for the utterance to be over, like the
+	// VAD's hangover on calls.
+	sttEndSilence = 700 * time.Millisecond
+
+	// sttMaxUtteranceBytes ends an utterance that never pauses, like the
+	// VAD's MaxUtterance. It is minutes of speech at recorder bitrates.
+	sttMaxUtteranceBytes = 2 << 20
+)
+
+var sttUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+// sttControl is a text message from a streaming transcription client.
+// {"type":"end"} says the client stopped its recorder: the utterance is
+// finished and the next binary message starts a new recording. Clients that
+// keep recording get a final result when the caller pauses instead.
+type sttControl struct {
+	Type string `json:"type"`
+}
+
+// sttJob is one transcription to run for a streaming client. A partial
+// job's audio is a snapshot of the first media bytes of the recording
+// generation it was taken from.
+type sttJob struct {
+	final    bool
+	audio    []byte
+	filename string
+
+	media      int
+	generation int
+}
+
+// sttStream transcribes one WebSocket client's recording. The read loop
+// only buffers audio; transcriptions run one at a time on a worker so a
+// slow request never stalls the socket. Partial jobs are dropped while the
+// worker is busy, since a newer one will follow, but final ones are not.
+//
+// When a partial hypothesis ends in a pause, the worker makes it final and
+// discards the media it covered. generation counts the times buffered media
+// was cut, discarded or reset, so that partial jobs taken before then are
+// known to be stale.
+type sttStream struct {
+	server    *Server
+	conn      *websocket.Conn
+	sessionID string
+	roomID    string
+	options   stt.Options
+
+	writeMu sync.Mutex
+	jobs    chan sttJob
+
+	mu          sync.Mutex
+	segmenter   *media.Segmenter
+	lastPartial int
+	generation  int
+}
+
+// handleSTTStream accepts MediaRecorder output as binary WebSocket messages
+// and answers with partial, final and error events. Browsers cannot set
+// headers on a WebSocket, so the session and room IDs may also be given as
+// the session_id and room_id query parameters; the session must be the
+// caller in the room. A comma-separated vocabulary parameter adds terms to
+// the recognizer prompt for this connection, and language chooses "en",
+// "hi" or "auto".
+func (s *Server) handleSTTStream(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session_id")
+	if sessionID == "" {
+		sessionID = r.Header.Get("X-Session-ID")
+	}
+	roomID := r.URL.Query().Get("room_id")
+	if roomID == "" {
+		roomID = r.Header.Get("X-Room-ID")
+	}
+	if s.sttCaller(w, roomID, sessionID) == nil {
+		return
+	}
+
+	if s.config.STTProvider == "openai" && s.config.OpenAIKey == "" {
+		http.Error(w, "STT not configured: missing OPENAI_API_KEY", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := sttUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("STT stream upgrade error: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	stream := &sttStream{
+		server:    s,
+		conn:      conn,
+		sessionID: sessionID,
+		roomID:    roomID,
+		jobs:      make(chan sttJob, 4),
+		segmenter: media.NewSegmenter(),
+		options: stt.Options{
+			Language: sttLanguage(r.URL.Query().Get("language")),
+			Prompt:   s.vocabulary.With(splitTerms(r.URL.Query().Get("vocabulary"))...).Prompt(),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		stream.transcribe(ctx)
+	}()
+
+	log.Printf("STT stream[%s/%s]: connected", roomID, sessionID)
+	stream.read()
+
+	// Whatever was recorded before the client went away is still an
+	// utterance; the worker finishes it before the socket closes.
+	stream.finish()
+	close(stream.jobs)
+	<-done
+	log.Printf("STT stream[%s/%s]: closed", roomID, sessionID)
+}
+
+func (st *sttStream) read() {
+	for {
+		messageType, data, err := st.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("STT stream[%s/%s]: %v", st.roomID, st.sessionID, err)
+			}
+			return
+		}
+
+		if messageType == websocket.TextMessage {
+			var control sttControl
+			if err := json.Unmarshal(data, &control); err != nil || control.Type != "end" {
+				st.send(models.STTEvent{Type: "error", Error: "unknown control message"})
+				continue
+			}
+			st.finish()
+			continue
+		}
+
+		job, ok, err := st.write(data)
+		if err != nil {
+			log.Printf("STT stream[%s/%s]: %v", st.roomID, st.sessionID, err)
+			st.send(models.STTEvent{Type: "error", Error: "invalid audio data"})
+			continue
+		}
+		if ok {
+			st.queue(job)
+		}
+	}
+}
+
+// write buffers recorder output and returns the transcription it calls
+// for, if any.
+func (st *sttStream) write(data []byte) (job sttJob, ok bool, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, err := st.segmenter.Write(data); err != nil {
+		st.reset()
+		return sttJob{}, false, err
+	}
+
+	switch buffered := st.segmenter.Buffered(); {
+	case buffered >= sttMaxUtteranceBytes:
+		job = sttJob{final: true, audio: st.segmenter.Cut(), filename: st.segmenter.Filename()}
+		st.lastPartial = 0
+		st.generation++
+		return job, true, nil
+	case buffered-st.lastPartial >= sttPartialBytes:
+		st.lastPartial = buffered
+		job = sttJob{audio: st.segmenter.Snapshot(), filename: st.segmenter.Filename(), media: buffered, generation: st.generation}
+		return job, true, nil
+	}
+	return sttJob{}, false, nil
+}
+
+// finish ends the current recording, transcribing what is left of it.
+func (st *sttStream) finish() {
+	st.mu.Lock()
+	st.segmenter.Finish()
+	audio := st.segmenter.Cut()
+	filename := st.segmenter.Filename()
+	st.reset()
+	st.mu.Unlock()
+
+	if audio != nil {
+		st.queue(sttJob{final: true, audio: audio, filename: filename})
+	}
+}
+
+// reset starts a new recording. st.mu must be held.
+func (st *sttStream) reset() {
+	st.segmenter = media.NewSegmenter()
+	st.lastPartial = 0
+	st.generation++
+}
+
+// stale reports whether media was cut, discarded or reset since the partial
+// job was taken.
+func (st *sttStream) stale(job sttJob) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return job.generation != st.generation
+}
+
+// discard drops the media a partial job covered, which the job's
+// transcription finished as an utterance. It reports false if the job is
+// stale.
+func (st *sttStream) discard(job sttJob) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if job.generation != st.generation {
+		return false
+	}
+	st.segmenter.Discard(job.media)
+	st.lastPartial = max(0, st.lastPartial-job.media)
+	st.generation++
+	return true
+}
+
+func (st *sttStream) queue(job sttJob) {
+	if job.final {
+		st.jobs <- job
+		return
+	}
+
+	select {
+	case st.jobs <- job:
+	default:
+	}
+}
+
+func (st *sttStream) transcribe(ctx context.Context) {
+	for job := range st.jobs {
+		if !job.final && st.stale(job) {
+			continue
+		}
+
+		speech, unclear, err := st.server.transcribeSpeech(ctx, job.audio, job.filename, st.options)
+		if err != nil {
+			log.Printf("STT stream[%s/%s]: %v", st.roomID, st.sessionID, err)
+			st.send(models.STTEvent{Type: "error", Error: "transcription failed"})
+			continue
+		}
+
+		final := job.final
+		if !final && endsInPause(speech) {
+			// The snapshot holds the whole utterance; what the client sent
+			// since starts the next one. Silence alone is dropped unreported.
+			if !st.discard(job) || (speech.Text == "" && !unclear) {
+				continue
+			}
+			final = true
+		}
+
+		eventType := "partial"
+		if final {
+			eventType = "final"
+			log.Printf("STT stream[%s/%s]: %s", st.roomID, st.sessionID, speech.Text)
+		}
+		st.send(models.STTEvent{Type: eventType, Text: speech.Text, Unclear: unclear})
+	}
+}
+
+// endsInPause reports whether the transcribed audio ran on for at least
+// sttEndSilence after its last speech, or held no speech for that long. It
+// is false when the transcriber reports no timings.
+func endsInPause(speech *stt.Transcript) bool {
+	_, end, ok := speech.Span()
+	if speech.Duration == 0 || (!ok && speech.Text != "") {
+		return false
+	}
+	return speech.Duration-end >= sttEndSilence
+}
+
+func (st *sttStream) send(event models.STTEvent) {
+	event.SessionID = st.sessionID
+	event.RoomID = st.roomID
+	event.Timestamp = time.Now()
+
+	st.writeMu.Lock()
+	defer st.writeMu.Unlock()
+
+	st.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := st.conn.WriteJSON(event); err != nil {
+		log.Printf("STT stream[%s/%s]: write: %v", st.roomID, st.sessionID, err)
+	}
+}
+
+func splitTerms(list string) []string {
+	if list == "" {
+		return nil
+	}
+	return strings.Split(list, ",")
+}
@@ -0,0 +1,187 @@
+// Package summary writes up finished calls for the service desk: what the
+// caller wanted, what was answered, what is left and how the call ended.
+package summary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"voice-agent/llm"
+	"voice-agent/models"
+)
+
+// Disposition codes say how a call ended.
+const (
+	// Resolved calls had every question answered.
+	Resolved = "resolved"
+	// FollowUp calls need someone from the team to get back to the caller.
+	FollowUp = "follow_up"
+	// Escalated calls were handed to the team during the call, such as
+	// when the agent could not understand the caller.
+	Escalated = "escalated"
+	// Abandoned calls ended before the caller's request was dealt with.
+	Abandoned = "abandoned"
+	// NoConversation calls ended without the caller saying anything.
+	NoConversation = "no_conversation"
+)
+
+// Dispositions are the codes the model chooses from.
+var Dispositions = []string{Resolved, FollowUp, Escalated, Abandoned}
+
+const toolName = "record_call_summary"
+
+const systemPrompt = `You review calls between customers and an insurance voice assistant for the service desk.
+Read the transcript and record a summary of the call by calling record_call_summary once.
+Only report what was said on the call. Leave policy_number empty unless a policy number was mentioned.
+Use follow_up for any call where the caller still needs something from the team.`
+
+// toolParameters is the JSON schema of the summary the model records.
+var toolParameters = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"caller_intent": {"type": "string", "description": "What the caller wanted, in one sentence."},
+		"policy_number": {"type": "string", "description": "The policy number discussed, if any."},
+		"questions_answered": {"type": "array", "items": {"type": "string"}, "description": "The caller's questions the assistant answered."},
+		"unresolved_items": {"type": "array", "items": {"type": "string"}, "description": "Questions or requests left open."},
+		"follow_up_needed": {"type": "boolean"},
+		"follow_up": {"type": "string", "description": "What the team should do next, if follow-up is needed."},
+		"disposition": {"type": "string", "enum": ["resolved", "follow_up", "escalated", "abandoned"]}
+	},
+	"required": ["caller_intent", "questions_answered", "unresolved_items", "follow_up_needed", "disposition"]
+}`)
+
+// Summarizer writes call summaries with a chat model.
+type Summarizer struct {
+	model llm.ChatModel
+}
+
+func New(model llm.ChatModel) *Summarizer {
+	return &Summarizer{model: model}
+}
+
+// Summarize writes up the call in entries, which must be one room's
+// transcript in order. A call where the caller never spoke is summarized
+// without asking the model.
+func (s *Summarizer) Summarize(ctx context.Context, entries []models.TranscriptEntry) (*models.CallSummary, error) {
+	if len(entries) == 0 {
+		return nil, errors.New("no transcript to summarize")
+	}
+
+	summary := &models.CallSummary{}
+	if !callerSpoke(entries) {
+		summary.CallerIntent = "The caller did not say anything."
+		summary.Disposition = NoConversation
+	} else {
+		tool := llm.Tool{
+			Type: "function",
+			Function: llm.FunctionDefinition{
+				Name:        toolName,
+				Description: "Record the summary of the call.",
+				Parameters:  toolParameters,
+			},
+		}
+		messages := []llm.Message{{Role: "user", Content: formatTranscript(entries)}}
+
+		reply, err := s.model.StreamChatCompletion(ctx, messages, systemPrompt, []llm.Tool{tool}, func(string) {})
+		if err != nil {
+			return nil, err
+		}
+		if err := parseReply(reply, summary); err != nil {
+			return nil, err
+		}
+	}
+
+	summary.RoomID = entries[0].RoomID
+	summary.SessionID = entries[0].SessionID
+	if summary.QuestionsAnswered == nil {
+		summary.QuestionsAnswered = []string{}
+	}
+	if summary.UnresolvedItems == nil {
+		summary.UnresolvedItems = []string{}
+	}
+	summary.CreatedAt = time.Now()
+	return summary, nil
+}
+
+func callerSpoke(entries []models.TranscriptEntry) bool {
+	for _, entry := range entries {
+		if entry.Speaker == "user" && strings.TrimSpace(entry.Text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTranscript lays the call out one line per message, with the time
+// into the call.
+func formatTranscript(entries []models.TranscriptEntry) string {
+	start := entries[0].Timestamp
+
+	var b strings.Builder
+	b.WriteString("Call transcript:\n")
+	for _, entry := range entries {
+		speaker := "Assistant"
+		if entry.Speaker == "user" {
+			speaker = "Caller"
+		}
+		elapsed := entry.Timestamp.Sub(start).Round(time.Second)
+		fmt.Fprintf(&b, "[%s] %s: %s\n", elapsed, speaker, entry.Text)
+	}
+	return b.String()
+}
+
+// parseReply reads the summary from the model's tool call or, for models
+// that answer in text instead, from JSON in the reply.
+func parseReply(reply llm.Message, summary *models.CallSummary) error {
+	arguments := ""
+	for _, call := range reply.ToolCalls {
+		if call.Function.Name == toolName {
+			arguments = call.Function.Arguments
+			break
+		}
+	}
+	if arguments == "" {
+		arguments = jsonObject(reply.Content)
+	}
+	if arguments == "" {
+		return errors.New("chat model did not record a summary")
+	}
+
+	if err := json.Unmarshal([]byte(arguments), summary); err != nil {
+		return fmt.Errorf("invalid call summary: %w", err)
+	}
+
+	// An unknown code still gets the call looked at.
+	if !validDisposition(summary.Disposition) {
+		log.Printf("Summary: unknown disposition %q, using %s", summary.Disposition, FollowUp)
+		summary.Disposition = FollowUp
+	}
+	if summary.Disposition == FollowUp {
+		summary.FollowUpNeeded = true
+	}
+	return nil
+}
+
+// jsonObject returns the outermost JSON object in text, such as one wrapped
+// in a Markdown code block.
+func jsonObject(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return ""
+	}
+	return text[start : end+1]
+}
+
+func validDisposition(code string) bool {
+	for _, d := range Dispositions {
+		if code == d {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package summary_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"voice-agent/fake"
+	"voice-agent/llm"
+	"voice-agent/models"
+	"voice-agent/summary"
+)
+
+// toolModel answers every request by calling the first tool it is given.
+type toolModel struct {
+	arguments string
+	tools     []llm.Tool
+	messages  []llm.Message
+}
+
+func (m *toolModel) StreamChatCompletion(ctx context.Context, messages []llm.Message, systemPrompt string, tools []llm.Tool, onDelta func(string)) (llm.Message, error) {
+	m.tools = tools
+	m.messages = messages
+	return llm.Message{
+		Role: "assistant",
+		ToolCalls: []llm.ToolCall{{
+			ID:       "call-1",
+			Type:     "function",
+			Function: llm.FunctionCall{Name: tools[0].Function.Name, Arguments: m.arguments},
+		}},
+	}, nil
+}
+
+func call(lines ...string) []models.TranscriptEntry {
+	start := time.Date(2026, 5, 3, 10, 0, 0, 0, time.UTC)
+	var entries []models.TranscriptEntry
+	for i := 0; i+1 < len(lines); i += 2 {
+		entries = append(entries, models.TranscriptEntry{
+			RoomID:    "room-1",
+			SessionID: "session-1",
+			TranscriptMessage: models.TranscriptMessage{
+				Type:      "transcript",
+				Speaker:   lines[i],
+				Text:      lines[i+1],
+				Timestamp: start.Add(time.Duration(i/2) * 5 * time.Second),
+			},
+		})
+	}
+	return entries
+}
+
+func TestSummarizeToolCall(t *testing.T) {
+	model := &toolModel{arguments: `{
+		"caller_intent": "Find out when policy POL-1234 expires",
+		"policy_number": "POL-1234",
+		"questions_answered": ["When does my policy expire?"],
+		"unresolved_items": ["Wants a renewal quote"],
+		"follow_up_needed": true,
+		"follow_up": "Send a renewal quote",
+		"disposition": "follow_up",
+		"room_id": "not-this-room"
+	}`}
+
+	got, err := summary.New(model).Summarize(context.Background(), call(
+		"agent", "Hi! How can I help?",
+		"user", "When does policy POL-1234 expire?",
+		"agent", "On 3 May 2027.",
+		"user", "Can you send me a renewal quote?",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.RoomID != "room-1" || got.SessionID != "session-1" || got.CreatedAt.IsZero() {
+		t.Errorf("summary not tied to the call: %+v", got)
+	}
+	if got.PolicyNumber != "POL-1234" || got.Disposition != summary.FollowUp || !got.FollowUpNeeded ||
+		len(got.QuestionsAnswered) != 1 || got.UnresolvedItems[0] != "Wants a renewal quote" {
+		t.Errorf("summary = %+v", got)
+	}
+
+	if len(model.tools) != 1 || len(model.messages) != 1 {
+		t.Fatalf("request: %d tools, %d messages", len(model.tools), len(model.messages))
+	}
+	if prompt := model.messages[0].Content; !strings.Contains(prompt, "[5s] Caller: When does policy POL-1234 expire?") {
+		t.Errorf("transcript sent to the model:\n%s", prompt)
+	}
+}
+
+func TestSummarizeTextReply(t *testing.T) {
+	model := fake.NewChatModel("Here is the summary:\n```json\n" +
+		`{"caller_intent": "Asked about cover", "questions_answered": ["What is covered?"], "unresolved_items": [], "follow_up_needed": false, "disposition": "closed"}` +
+		"\n```")
+
+	got, err := summary.New(model).Summarize(context.Background(), call(
+		"user", "What is covered?",
+		"agent", "Hospitalization.",
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An unknown disposition is flagged for follow-up rather than lost.
+	if got.CallerIntent != "Asked about cover" || got.Disposition != summary.FollowUp || !got.FollowUpNeeded {
+		t.Errorf("summary = %+v", got)
+	}
+}
+
+func TestSummarizeSilentCall(t *testing.T) {
+	model := fake.NewChatModel()
+	got, err := summary.New(model).Summarize(context.Background(), call("agent", "Hi! How can I help?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Disposition != summary.NoConversation || got.QuestionsAnswered == nil || len(model.Requests()) != 0 {
+		t.Errorf("summary = %+v after %d requests", got, len(model.Requests()))
+	}
+}
+
+func TestSummarizeNoSummary(t *testing.T) {
+	model := fake.NewChatModel("Sorry, I can't help with that.")
+	if _, err := summary.New(model).Summarize(context.Background(), call("user", "Hello?")); err == nil {
+		t.Error("reply without a summary accepted")
+	}
+}
@@ -0,0 +1,174 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+type Policy struct {
+	Summary struct {
+		Name         string `json:"name"`
+		Provider     string `json:"provider"`
+		UIN          string `json:"uin"`
+		PolicyNumber string `json:"policy_number"`
+	} `json:"policy_summary"`
+	People struct {
+		PolicyHolder struct {
+			Name    string `json:"name"`
+			Contact struct {
+				Mobile string `json:"mobile"`
+			} `json:"contact"`
+		} `json:"policy_holder"`
+		Type    string         `json:"type"`
+		Members []PolicyMember `json:"members"`
+	} `json:"people"`
+	// SumInsured is either a plain amount or a breakdown of base cover and
+	// accumulated bonuses, so it is passed through as is.
+	SumInsured   json.RawMessage `json:"sum_insured"`
+	PolicyPeriod struct {
+		DateOfPurchase string `json:"date_of_purchase"`
+		Start          string `json:"start"`
+		End            string `json:"end"`
+	} `json:"policy_period"`
+	Premium struct {
+		Amount      string            `json:"amount"`
+		Frequency   string            `json:"frequency"`
+		Breakdown   map[string]string `json:"breakdown"`
+		PaymentMode string            `json:"payment_mode"`
+	} `json:"premium"`
+}
+
+type PolicyMember struct {
+	Name         string `json:"name"`
+	Relationship string `json:"relationship"`
+	Age          int    `json:"age"`
+	DateOfBirth  string `json:"date_of_birth"`
+}
+
+// PolicyStore indexes purchased policies by the policy holder's mobile number.
+type PolicyStore struct {
+	byMobile map[string]*Policy
+}
+
+// LoadPolicies reads a purchase_policies.json file, which maps policy numbers
+// to policy documents.
+func LoadPolicies(path string) (*PolicyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var policies map[string]*Policy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("invalid policies file %s: %w", path, err)
+	}
+
+	store := &PolicyStore{byMobile: make(map[string]*Policy)}
+	for _, policy := range policies {
+		if mobile := NormalizeMobile(policy.People.PolicyHolder.Contact.Mobile); mobile != "" {
+			store.byMobile[mobile] = policy
+		}
+	}
+	return store, nil
+}
+
+// FindByMobile looks a policy up by the holder's mobile number in any common
+// spoken or written form ("+91 76785 82978", "07678582978").
+func (s *PolicyStore) FindByMobile(mobile string) (*Policy, bool) {
+	policy, ok := s.byMobile[NormalizeMobile(mobile)]
+	return policy, ok
+}
+
+// NormalizeMobile keeps the last ten digits of an Indian mobile number.
+func NormalizeMobile(mobile string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, mobile)
+
+	if len(digits) < 10 {
+		return ""
+	}
+	return digits[len(digits)-10:]
+}
+
+var mobileArgSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"mobile_number": {
+			"type": "string",
+			"description": "The policy holder's registered 10-digit mobile number."
+		}
+	},
+	"required": ["mobile_number"]
+}`)
+
+// RegisterPolicyTools adds the policy lookup tools backed by store.
+func RegisterPolicyTools(registry *Registry, store *PolicyStore) {
+	registry.Register("lookup_policy",
+		"Look up the caller's health insurance policy by registered mobile number. Returns the policy number, product, sum insured, policy period and premium.",
+		mobileArgSchema,
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			policy, err := store.policyFromArgs(args)
+			if err != nil {
+				return "", err
+			}
+
+			return marshalResult(map[string]interface{}{
+				"policy_number": policy.Summary.PolicyNumber,
+				"product":       policy.Summary.Name,
+				"provider":      policy.Summary.Provider,
+				"uin":           policy.Summary.UIN,
+				"policy_holder": policy.People.PolicyHolder.Name,
+				"sum_insured":   policy.SumInsured,
+				"policy_period": policy.PolicyPeriod,
+				"premium":       policy.Premium,
+				"coverage_type": policy.People.Type,
+				"member_count":  len(policy.People.Members),
+			})
+		})
+
+	registry.Register("list_policy_members",
+		"List the people insured under the caller's policy, looked up by registered mobile number.",
+		mobileArgSchema,
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			policy, err := store.policyFromArgs(args)
+			if err != nil {
+				return "", err
+			}
+
+			return marshalResult(map[string]interface{}{
+				"policy_number": policy.Summary.PolicyNumber,
+				"members":       policy.People.Members,
+			})
+		})
+}
+
+func (s *PolicyStore) policyFromArgs(args json.RawMessage) (*Policy, error) {
+	var params struct {
+		MobileNumber string `json:"mobile_number"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid arguments: %w", err)
+	}
+
+	policy, ok := s.FindByMobile(params.MobileNumber)
+	if !ok {
+		return nil, fmt.Errorf("no policy found for mobile number %s", params.MobileNumber)
+	}
+	return policy, nil
+}
+
+func marshalResult(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
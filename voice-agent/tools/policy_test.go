@@ -0,0 +1,92 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"voice-agent/tools"
+)
+
+// policiesFile is the policies file bundled with the Python app.
+const policiesFile = "../../Insurance/purchase_policies.json"
+
+func policyRegistry(t *testing.T) *tools.Registry {
+	t.Helper()
+	store, err := tools.LoadPolicies(policiesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := tools.NewRegistry()
+	tools.RegisterPolicyTools(registry, store)
+	return registry
+}
+
+func TestLookupPolicy(t *testing.T) {
+	registry := policyRegistry(t)
+
+	// The number is spoken with the country code and spaces.
+	msg := registry.Call(context.Background(), call("call_1", "lookup_policy", `{"mobile_number":"+91 76785 82977"}`))
+	var result struct {
+		PolicyNumber string `json:"policy_number"`
+		Product      string `json:"product"`
+		CoverageType string `json:"coverage_type"`
+		MemberCount  int    `json:"member_count"`
+		Premium      struct {
+			Amount string `json:"amount"`
+		} `json:"premium"`
+	}
+	if err := json.Unmarshal([]byte(msg.Content), &result); err != nil {
+		t.Fatalf("result %q: %v", msg.Content, err)
+	}
+	if result.PolicyNumber != "48711519" || result.Product != "CARE ADVANTAGE" || result.CoverageType != "Floater" || result.MemberCount != 4 {
+		t.Errorf("result = %+v", result)
+	}
+	if result.Premium.Amount == "" {
+		t.Error("result has no premium")
+	}
+
+	msg = registry.Call(context.Background(), call("call_2", "lookup_policy", `{"mobile_number":"9999999999"}`))
+	if got := errorOf(t, msg.Content); got != "no policy found for mobile number 9999999999" {
+		t.Errorf("miss: error = %q", got)
+	}
+}
+
+func TestListPolicyMembers(t *testing.T) {
+	registry := policyRegistry(t)
+
+	msg := registry.Call(context.Background(), call("call_1", "list_policy_members", `{"mobile_number":"07678582950"}`))
+	var result struct {
+		PolicyNumber string               `json:"policy_number"`
+		Members      []tools.PolicyMember `json:"members"`
+	}
+	if err := json.Unmarshal([]byte(msg.Content), &result); err != nil {
+		t.Fatalf("result %q: %v", msg.Content, err)
+	}
+	if result.PolicyNumber != "39654168" || len(result.Members) != 3 || result.Members[0].Name != "Saunak Sandip Shah" {
+		t.Errorf("result = %+v", result)
+	}
+
+	for _, args := range []string{`{"mobile_number":"12345"}`, `{}`} {
+		msg := registry.Call(context.Background(), call("call_2", "list_policy_members", args))
+		if got := errorOf(t, msg.Content); !strings.HasPrefix(got, "no policy found") {
+			t.Errorf("%s: error = %q", args, got)
+		}
+	}
+}
+
+func TestNormalizeMobile(t *testing.T) {
+	for in, want := range map[string]string{
+		"7678582978":       "7678582978",
+		"+91 76785 82978":  "7678582978",
+		"07678582978":      "7678582978",
+		"91-7678-582-978":  "7678582978",
+		"76785":            "",
+		"":                 "",
+		"seven six seven8": "",
+	} {
+		if got := tools.NormalizeMobile(in); got != want {
+			t.Errorf("NormalizeMobile(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package tools holds the Go functions the agent's chat model can call.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"voice-agent/llm"
+)
+
+// Handler runs a tool with the model's JSON arguments and returns the result
+// the model will see, usually a JSON document.
+type Handler func(ctx context.Context, args json.RawMessage) (string, error)
+
+type registeredTool struct {
+	definition llm.Tool
+	handler    Handler
+}
+
+type Registry struct {
+	tools map[string]registeredTool
+	order []string
+	mutex sync.RWMutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		tools: make(map[string]registeredTool),
+	}
+}
+
+// Register adds a tool. parameters is the JSON schema of its arguments.
+// Registering a name twice replaces the earlier tool.
+func (r *Registry) Register(name, description string, parameters json.RawMessage, handler Handler) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.tools[name]; !exists {
+		r.order = append(r.order, name)
+	}
+
+	r.tools[name] = registeredTool{
+		definition: llm.Tool{
+			Type: "function",
+			Function: llm.FunctionDefinition{
+				Name:        name,
+				Description: description,
+				Parameters:  parameters,
+			},
+		},
+		handler: handler,
+	}
+}
+
+// Definitions returns the tools in registration order, ready to send with a
+// chat completion request.
+func (r *Registry) Definitions() []llm.Tool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	definitions := make([]llm.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		definitions = append(definitions, r.tools[name].definition)
+	}
+	return definitions
+}
+
+// Call runs the tool the model asked for and returns the tool message to
+// send back. Failures are reported to the model rather than returned, so it
+// can tell the caller what went wrong.
+func (r *Registry) Call(ctx context.Context, call llm.ToolCall) llm.Message {
+	r.mutex.RLock()
+	tool, exists := r.tools[call.Function.Name]
+	r.mutex.RUnlock()
+
+	content := ""
+	if !exists {
+		content = errorResult(fmt.Errorf("unknown tool %q", call.Function.Name))
+	} else {
+		result, err := tool.handler(ctx, json.RawMessage(call.Function.Arguments))
+		if err != nil {
+			log.Printf("Tool %s failed: %v", call.Function.Name, err)
+			content = errorResult(err)
+		} else {
+			content = result
+		}
+	}
+
+	return llm.Message{
+		Role:       "tool",
+		Content:    content,
+		ToolCallID: call.ID,
+	}
+}
+
+func errorResult(err error) string {
+	data, _ := json.Marshal(map[string]string{"error": err.Error()})
+	return string(data)
+}
@@ -0,0 +1,77 @@
+package tools_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"voice-agent/llm"
+	"voice-agent/tools"
+)
+
+func call(id, name, args string) llm.ToolCall {
+	return llm.ToolCall{ID: id, Type: "function", Function: llm.FunctionCall{Name: name, Arguments: args}}
+}
+
+// errorOf returns the error a tool result reports, or "" if it reports none.
+func errorOf(t *testing.T, content string) string {
+	t.Helper()
+	var result struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		t.Fatalf("tool result %q is not JSON: %v", content, err)
+	}
+	return result.Error
+}
+
+func TestRegistry(t *testing.T) {
+	registry := tools.NewRegistry()
+	echo := func(ctx context.Context, args json.RawMessage) (string, error) {
+		var params struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(args, &params); err != nil {
+			return "", err
+		}
+		return `{"echo":"` + params.Text + `"}`, nil
+	}
+	registry.Register("echo", "Repeat the text.", json.RawMessage(`{"type":"object"}`), echo)
+	registry.Register("fail", "Always fail.", json.RawMessage(`{"type":"object"}`),
+		func(ctx context.Context, args json.RawMessage) (string, error) {
+			return "", errors.New("backend unavailable")
+		})
+	// Registering again replaces the tool without moving it.
+	registry.Register("echo", "Repeat the text back.", json.RawMessage(`{"type":"object"}`), echo)
+
+	definitions := registry.Definitions()
+	if len(definitions) != 2 || definitions[0].Function.Name != "echo" || definitions[1].Function.Name != "fail" {
+		t.Fatalf("definitions = %+v", definitions)
+	}
+	if got := definitions[0]; got.Type != "function" || got.Function.Description != "Repeat the text back." {
+		t.Errorf("echo definition = %+v", got)
+	}
+
+	msg := registry.Call(context.Background(), call("call_1", "echo", `{"text":"hi"}`))
+	if msg.Role != "tool" || msg.ToolCallID != "call_1" || msg.Content != `{"echo":"hi"}` {
+		t.Errorf("echo result = %+v", msg)
+	}
+
+	for _, tc := range []struct {
+		name string
+		call llm.ToolCall
+		want string
+	}{
+		{"unknown tool", call("call_2", "transfer_call", `{}`), `unknown tool "transfer_call"`},
+		{"bad arguments", call("call_3", "echo", `{"text":`), "unexpected end of JSON input"},
+		{"handler error", call("call_4", "fail", `{}`), "backend unavailable"},
+	} {
+		msg := registry.Call(context.Background(), tc.call)
+		if msg.Role != "tool" || msg.ToolCallID != tc.call.ID {
+			t.Errorf("%s: message = %+v", tc.name, msg)
+		}
+		if got := errorOf(t, msg.Content); got != tc.want {
+			t.Errorf("%s: error = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package transcripts
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"voice-agent/config"
+	"voice-agent/models"
+)
+
+func init() {
+	Register("jsonl", func(cfg *config.Config) (Store, error) {
+		return NewJSONL(cfg.TranscriptDir)
+	})
+}
+
+// JSONL stores each room's transcript as a file of JSON lines, named after
+// the room, in one directory. Summaries are JSON files beside them.
+type JSONL struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewJSONL(dir string) (*JSONL, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &JSONL{dir: dir}, nil
+}
+
+func (j *JSONL) Append(ctx context.Context, entry models.TranscriptEntry) error {
+	if !validRoomID(entry.RoomID) {
+		return ErrInvalidRoomID
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	file, err := os.OpenFile(j.path(entry.RoomID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (j *JSONL) Room(ctx context.Context, roomID string) ([]models.TranscriptEntry, error) {
+	if !validRoomID(roomID) {
+		return nil, ErrInvalidRoomID
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	file, err := os.Open(j.path(roomID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []models.TranscriptEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry models.TranscriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", filepath.Base(file.Name()), line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func (j *JSONL) SaveSummary(ctx context.Context, summary models.CallSummary) error {
+	if !validRoomID(summary.RoomID) {
+		return ErrInvalidRoomID
+	}
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	// Written aside and renamed, so a reader never sees half a summary.
+	path := j.summaryPath(summary.RoomID)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (j *JSONL) Summary(ctx context.Context, roomID string) (*models.CallSummary, error) {
+	if !validRoomID(roomID) {
+		return nil, ErrInvalidRoomID
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data, err := os.ReadFile(j.summaryPath(roomID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var summary models.CallSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func (j *JSONL) Close() error {
+	return nil
+}
+
+func (j *JSONL) path(roomID string) string {
+	return filepath.Join(j.dir, roomID+".jsonl")
+}
+
+func (j *JSONL) summaryPath(roomID string) string {
+	return filepath.Join(j.dir, roomID+".summary.json")
+}
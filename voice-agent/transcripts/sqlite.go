@@ -0,0 +1,162 @@
+//go:build sqlite
+
+package transcripts
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+	"voice-agent/config"
+	"voice-agent/models"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	Register("sqlite", func(cfg *config.Config) (Store, error) {
+		return NewSQLite(cfg.TranscriptDB)
+	})
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS transcript_messages (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	room_id       TEXT NOT NULL,
+	session_id    TEXT NOT NULL,
+	type          TEXT NOT NULL,
+	speaker       TEXT NOT NULL,
+	text          TEXT NOT NULL,
+	timestamp     TEXT NOT NULL,
+	start_seconds REAL,
+	end_seconds   REAL,
+	confidence    REAL
+);
+CREATE INDEX IF NOT EXISTS transcript_messages_room ON transcript_messages (room_id, id);
+CREATE TABLE IF NOT EXISTS call_summaries (
+	room_id    TEXT PRIMARY KEY,
+	session_id TEXT NOT NULL,
+	summary    TEXT NOT NULL
+);
+`
+
+// SQLite stores every transcript in one table of a SQLite database, and
+// call summaries, as JSON, in another.
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite opens the database at path, creating it and its table if
+// needed.
+func NewSQLite(path string) (*SQLite, error) {
+	// Writers wait for each other instead of failing with SQLITE_BUSY.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLite{db: db}, nil
+}
+
+func (s *SQLite) Append(ctx context.Context, entry models.TranscriptEntry) error {
+	if !validRoomID(entry.RoomID) {
+		return ErrInvalidRoomID
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO transcript_messages
+			(room_id, session_id, type, speaker, text, timestamp, start_seconds, end_seconds, confidence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.RoomID, entry.SessionID, entry.Type, entry.Speaker, entry.Text,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano), entry.Start, entry.End, entry.Confidence)
+	return err
+}
+
+func (s *SQLite) Room(ctx context.Context, roomID string) ([]models.TranscriptEntry, error) {
+	if !validRoomID(roomID) {
+		return nil, ErrInvalidRoomID
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT room_id, session_id, type, speaker, text, timestamp, start_seconds, end_seconds, confidence
+		FROM transcript_messages
+		WHERE room_id = ?
+		ORDER BY id`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.TranscriptEntry
+	for rows.Next() {
+		var (
+			entry                  models.TranscriptEntry
+			timestamp              string
+			start, end, confidence sql.NullFloat64
+		)
+		if err := rows.Scan(&entry.RoomID, &entry.SessionID, &entry.Type, &entry.Speaker, &entry.Text,
+			&timestamp, &start, &end, &confidence); err != nil {
+			return nil, err
+		}
+		if entry.Timestamp, err = time.Parse(time.RFC3339Nano, timestamp); err != nil {
+			return nil, err
+		}
+		entry.Start = nullFloat(start)
+		entry.End = nullFloat(end)
+		entry.Confidence = nullFloat(confidence)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *SQLite) SaveSummary(ctx context.Context, summary models.CallSummary) error {
+	if !validRoomID(summary.RoomID) {
+		return ErrInvalidRoomID
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO call_summaries (room_id, session_id, summary) VALUES (?, ?, ?)
+		ON CONFLICT (room_id) DO UPDATE SET session_id = excluded.session_id, summary = excluded.summary`,
+		summary.RoomID, summary.SessionID, string(data))
+	return err
+}
+
+func (s *SQLite) Summary(ctx context.Context, roomID string) (*models.CallSummary, error) {
+	if !validRoomID(roomID) {
+		return nil, ErrInvalidRoomID
+	}
+
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT summary FROM call_summaries WHERE room_id = ?`, roomID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var summary models.CallSummary
+	if err := json.Unmarshal([]byte(data), &summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func nullFloat(v sql.NullFloat64) *float64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Float64
+}
@@ -0,0 +1,18 @@
+//go:build !sqlite
+
+package transcripts
+
+import (
+	"errors"
+	"voice-agent/config"
+)
+
+// ErrSQLiteUnavailable is returned for the sqlite store in builds without
+// SQLite, which needs cgo.
+var ErrSQLiteUnavailable = errors.New("the sqlite transcript store requires building with -tags sqlite")
+
+func init() {
+	Register("sqlite", func(cfg *config.Config) (Store, error) {
+		return nil, ErrSQLiteUnavailable
+	})
+}
@@ -0,0 +1,17 @@
+//go:build sqlite
+
+package transcripts_test
+
+import (
+	"path/filepath"
+	"testing"
+	"voice-agent/transcripts"
+)
+
+func TestSQLite(t *testing.T) {
+	store, err := transcripts.NewSQLite(filepath.Join(t.TempDir(), "transcripts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
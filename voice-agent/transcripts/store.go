@@ -0,0 +1,81 @@
+// Package transcripts keeps what was said on each call after it ends.
+//
+// The jsonl store needs nothing but a directory. The sqlite store uses cgo
+// and is only in builds with -tags sqlite.
+package transcripts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"voice-agent/config"
+	"voice-agent/models"
+)
+
+// Store saves transcript messages, and the summary written once a call
+// ends, and reads them back. It is used from every call's goroutines at
+// once.
+type Store interface {
+	Append(ctx context.Context, entry models.TranscriptEntry) error
+	// Room returns the room's messages in the order they were appended,
+	// or none if the room has no transcript.
+	Room(ctx context.Context, roomID string) ([]models.TranscriptEntry, error)
+	// SaveSummary stores the summary of its room's call, replacing any
+	// earlier one.
+	SaveSummary(ctx context.Context, summary models.CallSummary) error
+	// Summary returns the room's summary, or nil if it has none.
+	Summary(ctx context.Context, roomID string) (*models.CallSummary, error)
+	Close() error
+}
+
+// ErrInvalidRoomID is returned for room IDs that cannot name a transcript.
+var ErrInvalidRoomID = errors.New("invalid room ID")
+
+// Factory creates a store from the service configuration.
+type Factory func(cfg *config.Config) (Store, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a store available under name. Backends register
+// themselves from init, so adding one needs no changes elsewhere.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// New creates the store registered under name.
+func New(name string, cfg *config.Config) (Store, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown transcript store %q (have %v)", name, Names())
+	}
+	return factory(cfg)
+}
+
+// Names lists the registered stores.
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validRoomID reports whether id is usable as a key, and as a file name.
+func validRoomID(id string) bool {
+	return id != "" && id != "." && id != ".." && filepath.Base(id) == id
+}
@@ -0,0 +1,122 @@
+package transcripts_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	"voice-agent/models"
+	"voice-agent/transcripts"
+)
+
+func entry(roomID, speaker, text string) models.TranscriptEntry {
+	return models.TranscriptEntry{
+		RoomID:    roomID,
+		SessionID: "session-" + roomID,
+		TranscriptMessage: models.TranscriptMessage{
+			Type:      "transcript",
+			Speaker:   speaker,
+			Text:      text,
+			Timestamp: time.Date(2026, 5, 3, 10, 0, 0, 123456789, time.UTC),
+		},
+	}
+}
+
+// testStore checks the behaviour every backend must share.
+func testStore(t *testing.T, store transcripts.Store) {
+	t.Helper()
+	defer store.Close()
+	ctx := context.Background()
+
+	start, end, confidence := 1.25, 2.5, 0.9
+	first := entry("room-1", "user", "What does my policy cover?")
+	first.Start, first.End, first.Confidence = &start, &end, &confidence
+
+	for _, e := range []models.TranscriptEntry{
+		first,
+		entry("room-2", "user", "Hello?"),
+		entry("room-1", "agent", "It covers hospitalization."),
+	} {
+		if err := store.Append(ctx, e); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+
+	got, err := store.Room(ctx, "room-1")
+	if err != nil {
+		t.Fatalf("Room: %v", err)
+	}
+	if len(got) != 2 || got[0].Text != first.Text || got[1].Speaker != "agent" {
+		t.Fatalf("room-1 = %+v", got)
+	}
+	if g := got[0]; g.SessionID != "session-room-1" || !g.Timestamp.Equal(first.Timestamp) ||
+		g.Start == nil || *g.Start != start || *g.End != end || *g.Confidence != confidence {
+		t.Errorf("first entry = %+v", g)
+	}
+	if got[1].Start != nil || got[1].Confidence != nil {
+		t.Errorf("timings invented for %+v", got[1])
+	}
+
+	if got, err := store.Room(ctx, "room-3"); err != nil || len(got) != 0 {
+		t.Errorf("unknown room = %+v, %v", got, err)
+	}
+	if _, err := store.Room(ctx, "../room-1"); !errors.Is(err, transcripts.ErrInvalidRoomID) {
+		t.Errorf("Room(../room-1) error = %v", err)
+	}
+
+	if got, err := store.Summary(ctx, "room-1"); err != nil || got != nil {
+		t.Errorf("summary before one was saved = %+v, %v", got, err)
+	}
+	for _, disposition := range []string{"follow_up", "resolved"} {
+		summary := models.CallSummary{
+			RoomID:            "room-1",
+			SessionID:         "session-room-1",
+			CallerIntent:      "Check hospitalization cover",
+			QuestionsAnswered: []string{"What does my policy cover?"},
+			Disposition:       disposition,
+			CreatedAt:         first.Timestamp,
+		}
+		if err := store.SaveSummary(ctx, summary); err != nil {
+			t.Fatalf("SaveSummary: %v", err)
+		}
+	}
+	summary, err := store.Summary(ctx, "room-1")
+	if err != nil || summary == nil {
+		t.Fatalf("Summary = %+v, %v", summary, err)
+	}
+	if summary.Disposition != "resolved" || summary.QuestionsAnswered[0] != "What does my policy cover?" || !summary.CreatedAt.Equal(first.Timestamp) {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// Calls append at the same time.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Append(ctx, entry("room-4", "user", "concurrent")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := store.Room(ctx, "room-4"); len(got) != 20 {
+		t.Errorf("concurrent appends stored %d entries", len(got))
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	dir := t.TempDir()
+	store, err := transcripts.NewJSONL(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	if _, err := os.Stat(filepath.Join(dir, "room-1.jsonl")); err != nil {
+		t.Errorf("room file: %v", err)
+	}
+}
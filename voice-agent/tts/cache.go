@@ -0,0 +1,306 @@
+package tts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const cacheExt = ".pcm"
+
+// Cache keeps synthesized PCM on disk so repeated phrases, such as the
+// greeting, are played without another TTS request. Only phrases marked
+// with Keep are cached; any other text, such as a reply read back to a
+// caller, is synthesized each time and never written to disk. Entries are
+// keyed by text, voice options and sample rate, and the least recently used
+// are evicted once the cache grows past its size limit. File modification
+// times record use, so the order survives restarts.
+type Cache struct {
+	inner    Synthesizer
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+	phrases map[string]bool
+}
+
+type cacheEntry struct {
+	size int64
+	used time.Time
+}
+
+// NewCache wraps inner with a cache in dir holding at most maxBytes of audio.
+func NewCache(inner Synthesizer, dir string, maxBytes int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		inner:    inner,
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*cacheEntry),
+		phrases:  make(map[string]bool),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		key, ok := strings.CutSuffix(name, cacheExt)
+		if !ok {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		c.entries[key] = &cacheEntry{size: info.Size(), used: info.ModTime()}
+		c.size += info.Size()
+	}
+
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// Synthesizer returns the cache as the synthesizer to use. When the wrapped
+// synthesizer can stream, streams pass straight through to it and only whole
+// phrases kept and spoken with StreamPCM are cached.
+func (c *Cache) Synthesizer() Synthesizer {
+	if streaming, ok := c.inner.(StreamingSynthesizer); ok {
+		return &streamingCache{Cache: c, streaming: streaming}
+	}
+	return c
+}
+
+type streamingCache struct {
+	*Cache
+	streaming StreamingSynthesizer
+}
+
+func (s *streamingCache) OpenStream(ctx context.Context, opts Options, sampleRate int) (TextStream, error) {
+	return s.streaming.OpenStream(ctx, opts, sampleRate)
+}
+
+// Keep marks phrases as worth caching.
+func (c *Cache) Keep(phrases ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, phrase := range phrases {
+		c.phrases[phrase] = true
+	}
+}
+
+func (c *Cache) kept(text string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.phrases[text]
+}
+
+func (c *Cache) StreamPCM(ctx context.Context, text string, opts Options, sampleRate int) (io.ReadCloser, error) {
+	if !c.kept(text) {
+		return c.inner.StreamPCM(ctx, text, opts, sampleRate)
+	}
+	key := cacheKey(text, opts, sampleRate)
+
+	if file, ok := c.open(key); ok {
+		return file, nil
+	}
+
+	audio, err := c.inner.StreamPCM(ctx, text, opts, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		log.Printf("TTS cache write failed: %v", err)
+		return audio, nil
+	}
+	return &cacheFill{cache: c, key: key, audio: audio, file: tmp}, nil
+}
+
+// ValidateVoice passes through to the wrapped synthesizer when it can
+// validate voices.
+func (c *Cache) ValidateVoice(ctx context.Context, voiceID string) error {
+	if validator, ok := c.inner.(VoiceValidator); ok {
+		return validator.ValidateVoice(ctx, voiceID)
+	}
+	return nil
+}
+
+// Prewarm keeps phrases and synthesizes every one that is not cached yet.
+func (c *Cache) Prewarm(ctx context.Context, phrases []string, opts Options, sampleRate int) error {
+	c.Keep(phrases...)
+	for _, phrase := range phrases {
+		if c.Contains(phrase, opts, sampleRate) {
+			continue
+		}
+
+		audio, err := c.StreamPCM(ctx, phrase, opts, sampleRate)
+		if err != nil {
+			return fmt.Errorf("synthesizing %q: %w", phrase, err)
+		}
+		_, err = io.Copy(io.Discard, audio)
+		audio.Close()
+		if err != nil {
+			return fmt.Errorf("synthesizing %q: %w", phrase, err)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether audio for text is cached.
+func (c *Cache) Contains(text string, opts Options, sampleRate int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.entries[cacheKey(text, opts, sampleRate)]
+	return ok
+}
+
+func (c *Cache) open(key string) (*os.File, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	path := c.path(key)
+	file, err := os.Open(path)
+	if err != nil {
+		c.size -= entry.size
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	entry.used = time.Now()
+	os.Chtimes(path, entry.used, entry.used)
+	return file, true
+}
+
+func (c *Cache) add(key, tmpPath string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmpPath, c.path(key)); err != nil {
+		log.Printf("TTS cache write failed: %v", err)
+		os.Remove(tmpPath)
+		return
+	}
+
+	if old, ok := c.entries[key]; ok {
+		c.size -= old.size
+	}
+	c.entries[key] = &cacheEntry{size: size, used: time.Now()}
+	c.size += size
+	c.evictLocked()
+}
+
+func (c *Cache) evictLocked() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].used.Before(c.entries[keys[j]].used)
+	})
+
+	for _, key := range keys {
+		if c.size <= c.maxBytes {
+			return
+		}
+		os.Remove(c.path(key))
+		c.size -= c.entries[key].size
+		delete(c.entries, key)
+	}
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.dir, key+cacheExt)
+}
+
+func cacheKey(text string, opts Options, sampleRate int) string {
+	// The output format only matters through the sample rate.
+	opts.OutputFormat = ""
+	data, _ := json.Marshal(struct {
+		Text       string  `json:"text"`
+		Options    Options `json:"options"`
+		SampleRate int     `json:"sample_rate"`
+	}{text, opts, sampleRate})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheFill streams audio from the wrapped synthesizer while copying it to a
+// temporary file, which becomes a cache entry only if the audio is read to
+// the end.
+type cacheFill struct {
+	cache *Cache
+	key   string
+	audio io.ReadCloser
+	file  *os.File
+	size  int64
+	err   error
+}
+
+func (f *cacheFill) Read(p []byte) (int, error) {
+	n, err := f.audio.Read(p)
+	if n > 0 && f.err == nil {
+		_, f.err = f.file.Write(p[:n])
+		f.size += int64(n)
+	}
+
+	if errors.Is(err, io.EOF) && f.file != nil {
+		f.finish()
+	}
+	return n, err
+}
+
+func (f *cacheFill) Close() error {
+	if f.file != nil {
+		f.file.Close()
+		os.Remove(f.file.Name())
+		f.file = nil
+	}
+	return f.audio.Close()
+}
+
+func (f *cacheFill) finish() {
+	path := f.file.Name()
+	closeErr := f.file.Close()
+	f.file = nil
+
+	if f.err != nil || closeErr != nil || f.size == 0 {
+		os.Remove(path)
+		return
+	}
+	f.cache.add(f.key, path, f.size)
+}
@@ -0,0 +1,104 @@
+package tts_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+	"voice-agent/fake"
+	"voice-agent/tts"
+)
+
+func readAll(t *testing.T, synth tts.Synthesizer, text string, opts tts.Options) []byte {
+	t.Helper()
+
+	audio, err := synth.StreamPCM(context.Background(), text, opts, 16000)
+	if err != nil {
+		t.Fatalf("StreamPCM(%q): %v", text, err)
+	}
+	defer audio.Close()
+
+	data, err := io.ReadAll(audio)
+	if err != nil {
+		t.Fatalf("reading %q: %v", text, err)
+	}
+	return data
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	inner := fake.NewSynthesizer()
+	voice := tts.Options{VoiceID: "voice-1"}
+
+	// Each phrase is 100 ms, 3200 bytes at 16 kHz; room for two.
+	inner.PerCharacter = 100 * time.Millisecond / 20
+	cache, err := tts.NewCache(inner, dir, 6400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Keep("Hello, how are you?.", "Goodbye for now sir.", "Interrupted halfway.")
+
+	first := readAll(t, cache, "Hello, how are you?.", voice)
+	again := readAll(t, cache, "Hello, how are you?.", voice)
+	if string(first) != string(again) || len(first) != 3200 {
+		t.Errorf("cached audio differs: %d and %d bytes", len(first), len(again))
+	}
+	if n := len(inner.Texts()); n != 1 {
+		t.Errorf("synthesized %d times, want 1", n)
+	}
+
+	// Any change to the voice is a different entry.
+	readAll(t, cache, "Hello, how are you?.", tts.Options{VoiceID: "voice-1", Speed: 1.1})
+	if n := len(inner.Texts()); n != 2 {
+		t.Errorf("synthesized %d times, want 2", n)
+	}
+
+	// A third phrase evicts the least recently used one.
+	readAll(t, cache, "Hello, how are you?.", voice)
+	readAll(t, cache, "Goodbye for now sir.", voice)
+	if !cache.Contains("Hello, how are you?.", voice, 16000) {
+		t.Error("recently used phrase was evicted")
+	}
+	if cache.Contains("Hello, how are you?.", tts.Options{VoiceID: "voice-1", Speed: 1.1}, 16000) {
+		t.Error("least recently used phrase was kept")
+	}
+
+	// An abandoned stream is not cached.
+	audio, _ := cache.StreamPCM(context.Background(), "Interrupted halfway.", voice, 16000)
+	audio.Read(make([]byte, 100))
+	audio.Close()
+	if cache.Contains("Interrupted halfway.", voice, 16000) {
+		t.Error("partial audio was cached")
+	}
+
+	// The index is rebuilt from disk, and prewarming skips what is there.
+	reopened, err := tts.NewCache(inner, dir, 6400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := len(inner.Texts())
+	if err := reopened.Prewarm(context.Background(), []string{"Hello, how are you?.", "Please wait, friend."}, voice, 16000); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(inner.Texts()) - before; n != 1 {
+		t.Errorf("prewarm synthesized %d phrases, want 1", n)
+	}
+
+	// Text that was not kept, such as a reply, is synthesized every time and
+	// never written to disk.
+	before = len(inner.Texts())
+	readAll(t, reopened, "Your policy 48711519 is active.", voice)
+	readAll(t, reopened, "Your policy 48711519 is active.", voice)
+	if n := len(inner.Texts()) - before; n != 2 {
+		t.Errorf("reply synthesized %d times, want 2", n)
+	}
+	if reopened.Contains("Your policy 48711519 is active.", voice, 16000) {
+		t.Error("reply was cached")
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 2 {
+		t.Errorf("cache holds %d files, want 2", len(files))
+	}
+}
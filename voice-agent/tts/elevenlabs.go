@@ -2,89 +2,127 @@ package tts
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"voice-agent/config"
+)
+
+func init() {
+	Register("elevenlabs", func(cfg *config.Config) (Synthesizer, error) {
+		return NewElevenLabs(cfg.ElevenLabsKey), nil
+	})
+}
+
+const (
+	defaultVoiceID      = "1qEiC6qsybMkmnNdVMbK"
+	defaultModelID      = "eleven_flash_v2_5"
+	defaultOutputFormat = "mp3_44100_128"
+
+	elevenLabsBaseURL = "https://api.elevenlabs.io"
+
+	// voiceCacheTTL is how long a GetVoices result is trusted for
+	// validation. After a failed fetch, voiceRetryInterval passes before
+	// the next one, and the stale list, if any, is used meanwhile.
+	voiceCacheTTL      = 10 * time.Minute
+	voiceRetryInterval = time.Minute
 )
 
 type ElevenLabs struct {
-	apiKey string
-	client *http.Client
+	apiKey  string
+	baseURL string
+	client  *http.Client
+
+	voicesMu      sync.Mutex
+	voices        map[string]Voice
+	voicesFetched time.Time
+	// voicesFailed is when fetching the voices last failed, and voicesErr
+	// why.
+	voicesFailed time.Time
+	voicesErr    error
 }
 
 type TTSRequest struct {
-	Text          string                 `json:"text"`
-	ModelID       string                 `json:"model_id"`
-	VoiceSettings map[string]interface{} `json:"voice_settings,omitempty"`
+	Text          string                `json:"text"`
+	ModelID       string                `json:"model_id"`
+	VoiceSettings *voiceSettingsPayload `json:"voice_settings,omitempty"`
+}
+
+// voiceSettingsPayload is VoiceSettings as sent to the API, which carries
+// the speaking speed alongside the voice tuning.
+type voiceSettingsPayload struct {
+	VoiceSettings
+	Speed float64 `json:"speed,omitempty"`
 }
 
 func NewElevenLabs(apiKey string) *ElevenLabs {
 	return &ElevenLabs{
-		apiKey: apiKey,
-		client: &http.Client{},
+		apiKey:  apiKey,
+		baseURL: elevenLabsBaseURL,
+		client:  &http.Client{},
 	}
 }
 
-func (e *ElevenLabs) StreamSpeech(text, voiceID string) (io.ReadCloser, error) {
-	url := fmt.Sprintf("https://api.elevenlabs.io/v1/text-to-speech/%s/stream", "1qEiC6qsybMkmnNdVMbK")
-
-	payload := TTSRequest{
-		Text:    text,
-		ModelID: "eleven_flash_v2_5",
-		VoiceSettings: map[string]interface{}{
-			"stability":        0.5,
-			"similarity_boost": 0.75,
-		},
-	}
-
-	jsonPayload, err := json.Marshal(payload)
+// StreamSpeech streams speech in opts.OutputFormat, MP3 by default.
+func (e *ElevenLabs) StreamSpeech(ctx context.Context, text string, opts Options) (io.ReadCloser, error) {
+	resp, err := e.synthesize(ctx, text, opts, "/stream", opts.OutputFormat, "audio/mpeg")
 	if err != nil {
 		return nil, err
 	}
+	return resp.Body, nil
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+// StreamPCM streams speech as raw mono 16-bit little-endian PCM at
+// sampleRate, which must be one of the rates ElevenLabs offers as a pcm_*
+// output format. opts.OutputFormat is ignored. Cancelling ctx aborts the
+// request and the returned stream.
+func (e *ElevenLabs) StreamPCM(ctx context.Context, text string, opts Options, sampleRate int) (io.ReadCloser, error) {
+	resp, err := e.synthesize(ctx, text, opts, "/stream", fmt.Sprintf("pcm_%d", sampleRate), "audio/pcm")
 	if err != nil {
 		return nil, err
 	}
+	return resp.Body, nil
+}
 
-	req.Header.Set("Accept", "audio/mpeg")
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("xi-api-key", e.apiKey)
-
-	resp, err := e.client.Do(req)
+// GenerateSpeech returns the whole clip in opts.OutputFormat, MP3 by default.
+func (e *ElevenLabs) GenerateSpeech(ctx context.Context, text string, opts Options) ([]byte, error) {
+	resp, err := e.synthesize(ctx, text, opts, "", opts.OutputFormat, "audio/mpeg")
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		return nil, fmt.Errorf("ElevenLabs API error: %s", string(body))
-	}
-
-	return resp.Body, nil
+	return io.ReadAll(resp.Body)
 }
 
-func (e *ElevenLabs) GenerateSpeech(text, voiceID string) ([]byte, error) {
-	url := fmt.Sprintf("https://api.elevenlabs.io/v1/text-to-speech/%s", "1qEiC6qsybMkmnNdVMbK")
-
-	payload := TTSRequest{
-		Text:    text,
-		ModelID: "eleven_flash_v2_5",
+func (e *ElevenLabs) synthesize(ctx context.Context, text string, opts Options, suffix, format, accept string) (*http.Response, error) {
+	voiceID := opts.VoiceID
+	if voiceID == "" {
+		voiceID = defaultVoiceID
 	}
+	if format == "" {
+		format = defaultOutputFormat
+	}
+
+	endpoint := fmt.Sprintf("%s/v1/text-to-speech/%s%s?output_format=%s",
+		e.baseURL, url.PathEscape(voiceID), suffix, url.QueryEscape(format))
 
-	jsonPayload, err := json.Marshal(payload)
+	jsonPayload, err := json.Marshal(newTTSRequest(text, opts))
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Accept", "audio/mpeg")
+	req.Header.Set("Accept", accept)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("xi-api-key", e.apiKey)
 
@@ -92,14 +130,32 @@ func (e *ElevenLabs) GenerateSpeech(text, voiceID string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
 		return nil, fmt.Errorf("ElevenLabs API error: %s", string(body))
 	}
 
-	return io.ReadAll(resp.Body)
+	return resp, nil
+}
+
+func newTTSRequest(text string, opts Options) TTSRequest {
+	payload := TTSRequest{
+		Text:    text,
+		ModelID: opts.ModelID,
+	}
+	if payload.ModelID == "" {
+		payload.ModelID = defaultModelID
+	}
+
+	if opts.Settings != nil || opts.Speed != 0 {
+		payload.VoiceSettings = &voiceSettingsPayload{Speed: opts.Speed}
+		if opts.Settings != nil {
+			payload.VoiceSettings.VoiceSettings = *opts.Settings
+		}
+	}
+	return payload
 }
 
 type Voice struct {
@@ -107,8 +163,8 @@ type Voice struct {
 	Name    string `json:"name"`
 }
 
-func (e *ElevenLabs) GetVoices() ([]Voice, error) {
-	req, err := http.NewRequest("GET", "https://api.elevenlabs.io/v1/voices", nil)
+func (e *ElevenLabs) GetVoices(ctx context.Context) ([]Voice, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", e.baseURL+"/v1/voices", nil)
 	if err != nil {
 		return nil, err
 	}
@@ -121,6 +177,11 @@ func (e *ElevenLabs) GetVoices() ([]Voice, error) {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ElevenLabs API error: %s", string(body))
+	}
+
 	var result struct {
 		Voices []Voice `json:"voices"`
 	}
@@ -131,3 +192,36 @@ func (e *ElevenLabs) GetVoices() ([]Voice, error) {
 
 	return result.Voices, nil
 }
+
+// ValidateVoice checks voiceID against the account's voices, fetched with
+// GetVoices and cached for voiceCacheTTL. A failed fetch is not retried for
+// voiceRetryInterval, so an outage does not hold up every session start. If
+// the list cannot be fetched and nothing is cached, the error says so and
+// the caller may choose to go on.
+func (e *ElevenLabs) ValidateVoice(ctx context.Context, voiceID string) error {
+	e.voicesMu.Lock()
+	defer e.voicesMu.Unlock()
+
+	stale := e.voices == nil || time.Since(e.voicesFetched) > voiceCacheTTL
+	if stale && time.Since(e.voicesFailed) > voiceRetryInterval {
+		voices, err := e.GetVoices(ctx)
+		if err != nil {
+			e.voicesFailed = time.Now()
+			e.voicesErr = err
+		} else {
+			e.voices = make(map[string]Voice, len(voices))
+			for _, voice := range voices {
+				e.voices[voice.VoiceID] = voice
+			}
+			e.voicesFetched = time.Now()
+		}
+	}
+	if e.voices == nil {
+		return fmt.Errorf("%w: %v", ErrVoiceListUnavailable, e.voicesErr)
+	}
+
+	if _, ok := e.voices[voiceID]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownVoice, voiceID)
+	}
+	return nil
+}
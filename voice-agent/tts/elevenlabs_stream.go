@@ -0,0 +1,281 @@
+package tts
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"voice-agent/config"
+
+	"github.com/gorilla/websocket"
+)
+
+func init() {
+	Register("elevenlabs-ws", func(cfg *config.Config) (Synthesizer, error) {
+		return NewElevenLabsStream(cfg.ElevenLabsKey, cfg.ElevenLabsWSURL), nil
+	})
+}
+
+// ElevenLabsStream synthesizes over ElevenLabs' stream-input WebSocket API,
+// which takes text as it is generated and returns audio with character
+// alignment on the same socket. Voice listing and validation go through the
+// HTTP API.
+type ElevenLabsStream struct {
+	*ElevenLabs
+	baseURL string
+	dialer  *websocket.Dialer
+}
+
+// elevenLabsStreamMessage is a message sent on the socket. The first one
+// carries the voice settings; one with empty text ends the input.
+type elevenLabsStreamMessage struct {
+	Text          string                `json:"text"`
+	Flush         bool                  `json:"flush,omitempty"`
+	VoiceSettings *voiceSettingsPayload `json:"voice_settings,omitempty"`
+}
+
+// elevenLabsStreamResponse is a message received on the socket.
+type elevenLabsStreamResponse struct {
+	Audio     string `json:"audio"`
+	IsFinal   bool   `json:"isFinal"`
+	Alignment *struct {
+		Chars            []string `json:"chars"`
+		CharStartTimesMs []int    `json:"charStartTimesMs"`
+	} `json:"alignment"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// NewElevenLabsStream creates the WebSocket client. baseURL is the socket
+// origin, normally "wss://api.elevenlabs.io".
+func NewElevenLabsStream(apiKey, baseURL string) *ElevenLabsStream {
+	return &ElevenLabsStream{
+		ElevenLabs: NewElevenLabs(apiKey),
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		dialer:     websocket.DefaultDialer,
+	}
+}
+
+// StreamPCM speaks a complete text over a fresh socket.
+func (e *ElevenLabsStream) StreamPCM(ctx context.Context, text string, opts Options, sampleRate int) (io.ReadCloser, error) {
+	stream, err := e.OpenStream(ctx, opts, sampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stream.WriteText(text); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	if err := stream.CloseText(); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return stream.(io.ReadCloser), nil
+}
+
+func (e *ElevenLabsStream) OpenStream(ctx context.Context, opts Options, sampleRate int) (TextStream, error) {
+	voiceID := opts.VoiceID
+	if voiceID == "" {
+		voiceID = defaultVoiceID
+	}
+	modelID := opts.ModelID
+	if modelID == "" {
+		modelID = defaultModelID
+	}
+
+	query := url.Values{}
+	query.Set("model_id", modelID)
+	query.Set("output_format", fmt.Sprintf("pcm_%d", sampleRate))
+	endpoint := fmt.Sprintf("%s/v1/text-to-speech/%s/stream-input?%s", e.baseURL, url.PathEscape(voiceID), query.Encode())
+
+	header := http.Header{}
+	header.Set("xi-api-key", e.apiKey)
+
+	conn, resp, err := e.dialer.DialContext(ctx, endpoint, header)
+	if err != nil {
+		if resp != nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			return nil, fmt.Errorf("ElevenLabs stream error: %v: %s", err, string(body))
+		}
+		return nil, err
+	}
+
+	// The socket opens with a single space and the voice settings.
+	settings := newTTSRequest("", opts).VoiceSettings
+	if err := conn.WriteJSON(elevenLabsStreamMessage{Text: " ", VoiceSettings: settings}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	s := &elevenLabsTextStream{
+		conn:       conn,
+		audio:      pr,
+		audioW:     pw,
+		sampleRate: sampleRate,
+		done:       make(chan struct{}),
+	}
+	go s.receive()
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+type elevenLabsTextStream struct {
+	conn       *websocket.Conn
+	audio      *io.PipeReader
+	audioW     *io.PipeWriter
+	sampleRate int
+
+	writeMu sync.Mutex
+	pending string
+
+	mu        sync.Mutex
+	alignment Alignment
+	received  time.Duration
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (s *elevenLabsTextStream) Read(p []byte) (int, error) {
+	return s.audio.Read(p)
+}
+
+// WriteText sends text up to the last word boundary. ElevenLabs treats each
+// message as ending a word, so a word split across writes is held back
+// until it is complete.
+func (s *elevenLabsTextStream) WriteText(text string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.pending += text
+	cut := strings.LastIndexFunc(s.pending, unicode.IsSpace)
+	if cut < 0 {
+		return nil
+	}
+
+	// The space may be several bytes, as a no-break space is.
+	_, size := utf8.DecodeRuneInString(s.pending[cut:])
+	chunk := strings.TrimSpace(s.pending[:cut])
+	s.pending = s.pending[cut+size:]
+	if chunk == "" {
+		return nil
+	}
+	return s.conn.WriteJSON(elevenLabsStreamMessage{Text: chunk + " "})
+}
+
+func (s *elevenLabsTextStream) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.flushLocked()
+}
+
+func (s *elevenLabsTextStream) flushLocked() error {
+	chunk := strings.TrimSpace(s.pending)
+	s.pending = ""
+	if chunk == "" {
+		chunk = " "
+	} else {
+		chunk += " "
+	}
+	return s.conn.WriteJSON(elevenLabsStreamMessage{Text: chunk, Flush: true})
+}
+
+func (s *elevenLabsTextStream) CloseText() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if strings.TrimSpace(s.pending) != "" {
+		if err := s.flushLocked(); err != nil {
+			return err
+		}
+	}
+	return s.conn.WriteJSON(elevenLabsStreamMessage{Text: ""})
+}
+
+func (s *elevenLabsTextStream) Alignment() Alignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Alignment{
+		Chars:  append([]string(nil), s.alignment.Chars...),
+		Starts: append([]time.Duration(nil), s.alignment.Starts...),
+	}
+}
+
+func (s *elevenLabsTextStream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.conn.Close()
+		s.audio.Close()
+	})
+	return nil
+}
+
+// receive copies audio from the socket into the pipe read by Read. The
+// alignment of each chunk is relative to that chunk, so it is shifted by
+// the audio already received.
+func (s *elevenLabsTextStream) receive() {
+	for {
+		var msg elevenLabsStreamResponse
+		if err := s.conn.ReadJSON(&msg); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				s.audioW.Close()
+			} else {
+				s.audioW.CloseWithError(err)
+			}
+			return
+		}
+
+		if msg.Error != "" || (msg.Message != "" && msg.Audio == "") {
+			s.audioW.CloseWithError(fmt.Errorf("ElevenLabs stream error: %s %s", msg.Error, msg.Message))
+			return
+		}
+
+		if msg.Audio != "" {
+			pcm, err := base64.StdEncoding.DecodeString(msg.Audio)
+			if err != nil {
+				s.audioW.CloseWithError(fmt.Errorf("invalid audio chunk: %w", err))
+				return
+			}
+
+			s.mu.Lock()
+			offset := s.received
+			s.received += time.Duration(len(pcm)/2) * time.Second / time.Duration(s.sampleRate)
+			if a := msg.Alignment; a != nil {
+				for i, char := range a.Chars {
+					if i >= len(a.CharStartTimesMs) {
+						break
+					}
+					s.alignment.Chars = append(s.alignment.Chars, char)
+					s.alignment.Starts = append(s.alignment.Starts, offset+time.Duration(a.CharStartTimesMs[i])*time.Millisecond)
+				}
+			}
+			s.mu.Unlock()
+
+			if _, err := s.audioW.Write(pcm); err != nil {
+				return
+			}
+		}
+
+		if msg.IsFinal {
+			s.audioW.Close()
+			return
+		}
+	}
+}
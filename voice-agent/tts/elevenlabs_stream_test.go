@@ -0,0 +1,110 @@
+package tts_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+	"voice-agent/fake"
+	"voice-agent/tts"
+)
+
+func TestElevenLabsStream(t *testing.T) {
+	server := fake.NewElevenLabsServer()
+	defer server.Close()
+
+	client := tts.NewElevenLabsStream("test-key", server.URL())
+	stream, err := client.OpenStream(context.Background(), tts.Options{VoiceID: "voice-1", Speed: 1.2}, 16000)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	defer stream.Close()
+
+	// Deltas split words; only whole words may be sent.
+	for _, delta := range []string{"Your pol", "icy is ", "active.", " Any", "thing else?"} {
+		if err := stream.WriteText(delta); err != nil {
+			t.Fatalf("WriteText: %v", err)
+		}
+		if strings.HasSuffix(delta, ".") {
+			stream.Flush()
+		}
+	}
+	if err := stream.CloseText(); err != nil {
+		t.Fatalf("CloseText: %v", err)
+	}
+
+	pcm, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("reading audio: %v", err)
+	}
+
+	alignment := stream.Alignment()
+	text := alignment.Text()
+	if text != "Your policy is active. Anything else? " {
+		t.Errorf("aligned text = %q", text)
+	}
+	want := time.Duration(len(text)) * server.PerCharacter
+	if got := time.Duration(len(pcm)/2) * time.Second / 16000; got < want-time.Millisecond || got > want+time.Millisecond {
+		t.Errorf("audio lasts %v, want %v", got, want)
+	}
+
+	// The second chunk's alignment continues from the end of the first.
+	second := strings.Index(text, "Anything")
+	if got, want := alignment.Starts[second], time.Duration(second)*server.PerCharacter; got != want {
+		t.Errorf("second chunk starts at %v, want %v", got, want)
+	}
+	if got := alignment.SpokenBy(5 * server.PerCharacter); got != "Your " {
+		t.Errorf("SpokenBy = %q", got)
+	}
+
+	for _, msg := range server.Messages() {
+		if text, _ := msg["text"].(string); text != "" && text != " " && !strings.HasSuffix(text, " ") {
+			t.Errorf("chunk %q does not end on a word boundary", text)
+		}
+	}
+	if first := server.Messages()[0]; first["voice_settings"].(map[string]interface{})["speed"] != 1.2 {
+		t.Errorf("first message = %v, want voice settings with speed", first)
+	}
+	if path := server.Paths()[0]; !strings.HasPrefix(path, "/v1/text-to-speech/voice-1/stream-input?") || !strings.Contains(path, "output_format=pcm_16000") {
+		t.Errorf("connected to %s", path)
+	}
+}
+
+func TestElevenLabsStreamWideSpace(t *testing.T) {
+	server := fake.NewElevenLabsServer()
+	defer server.Close()
+
+	client := tts.NewElevenLabsStream("test-key", server.URL())
+	stream, err := client.OpenStream(context.Background(), tts.Options{VoiceID: "voice-1"}, 16000)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	defer stream.Close()
+
+	// A no-break space and an ideographic space are two and three bytes.
+	for _, delta := range []string{"Sum insured\u00a0", "Rs.\u3000five", " lakh."} {
+		if err := stream.WriteText(delta); err != nil {
+			t.Fatalf("WriteText: %v", err)
+		}
+	}
+	if err := stream.CloseText(); err != nil {
+		t.Fatalf("CloseText: %v", err)
+	}
+	io.ReadAll(stream)
+
+	var sent []string
+	for _, msg := range server.Messages() {
+		if text, _ := msg["text"].(string); strings.TrimSpace(text) != "" {
+			// Invalid UTF-8 arrives as replacement characters.
+			if strings.ContainsRune(text, utf8.RuneError) {
+				t.Errorf("chunk %q was not valid UTF-8", text)
+			}
+			sent = append(sent, strings.TrimSpace(text))
+		}
+	}
+	if got := strings.Join(sent, " "); got != "Sum insured Rs. five lakh." {
+		t.Errorf("sent %q", got)
+	}
+}
@@ -0,0 +1,69 @@
+package tts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateVoice(t *testing.T) {
+	var requests atomic.Int32
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"voices":[{"voice_id":"voice-1","name":"Asha"}]}`))
+	}))
+	defer server.Close()
+
+	e := NewElevenLabs("test-key")
+	e.baseURL = server.URL
+
+	if err := e.ValidateVoice(context.Background(), "voice-1"); err != nil {
+		t.Fatalf("known voice: %v", err)
+	}
+	if err := e.ValidateVoice(context.Background(), "voice-2"); !errors.Is(err, ErrUnknownVoice) {
+		t.Errorf("unknown voice: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests, want the list fetched once", n)
+	}
+
+	// Once the list is stale and ElevenLabs is down, one failed fetch is
+	// enough; the stale list serves until the retry interval passes.
+	down.Store(true)
+	e.voicesFetched = time.Now().Add(-voiceCacheTTL - time.Second)
+	for range 3 {
+		if err := e.ValidateVoice(context.Background(), "voice-1"); err != nil {
+			t.Fatalf("stale list: %v", err)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests, want one retry", n)
+	}
+
+	e.voicesFailed = time.Now().Add(-voiceRetryInterval - time.Second)
+	e.ValidateVoice(context.Background(), "voice-1")
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d requests, want a retry after the interval", n)
+	}
+
+	// With nothing cached, the failure backs off too.
+	fresh := NewElevenLabs("test-key")
+	fresh.baseURL = server.URL
+	for range 2 {
+		if err := fresh.ValidateVoice(context.Background(), "voice-1"); !errors.Is(err, ErrVoiceListUnavailable) {
+			t.Errorf("no list: %v", err)
+		}
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("%d requests, want one for the empty cache", n)
+	}
+}
@@ -0,0 +1,83 @@
+package tts
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Options choose how speech sounds. Zero fields fall back to the
+// synthesizer's defaults, so a partial set of options can be layered over
+// the configured ones with Merge.
+type Options struct {
+	VoiceID string `json:"voice_id,omitempty"`
+	ModelID string `json:"model_id,omitempty"`
+	// OutputFormat is a vendor format name such as "mp3_44100_128" or
+	// "pcm_24000". For playback to a call only the sample rate of a pcm_*
+	// format is used; see PCMSampleRate.
+	OutputFormat string `json:"output_format,omitempty"`
+	// Speed scales the speaking rate; 1 is normal.
+	Speed    float64        `json:"speed,omitempty"`
+	Settings *VoiceSettings `json:"voice_settings,omitempty"`
+}
+
+// VoiceSettings tune an ElevenLabs voice. Nil fields are left to the voice's
+// stored settings.
+type VoiceSettings struct {
+	Stability       *float64 `json:"stability,omitempty"`
+	SimilarityBoost *float64 `json:"similarity_boost,omitempty"`
+	Style           *float64 `json:"style,omitempty"`
+	UseSpeakerBoost *bool    `json:"use_speaker_boost,omitempty"`
+}
+
+// Merge returns o with every field set in override replacing its own.
+func (o Options) Merge(override Options) Options {
+	if override.VoiceID != "" {
+		o.VoiceID = override.VoiceID
+	}
+	if override.ModelID != "" {
+		o.ModelID = override.ModelID
+	}
+	if override.OutputFormat != "" {
+		o.OutputFormat = override.OutputFormat
+	}
+	if override.Speed != 0 {
+		o.Speed = override.Speed
+	}
+	if override.Settings != nil {
+		o.Settings = o.Settings.merge(override.Settings)
+	}
+	return o
+}
+
+func (s *VoiceSettings) merge(override *VoiceSettings) *VoiceSettings {
+	merged := VoiceSettings{}
+	if s != nil {
+		merged = *s
+	}
+	if override.Stability != nil {
+		merged.Stability = override.Stability
+	}
+	if override.SimilarityBoost != nil {
+		merged.SimilarityBoost = override.SimilarityBoost
+	}
+	if override.Style != nil {
+		merged.Style = override.Style
+	}
+	if override.UseSpeakerBoost != nil {
+		merged.UseSpeakerBoost = override.UseSpeakerBoost
+	}
+	return &merged
+}
+
+// PCMSampleRate returns the sample rate of a "pcm_<rate>" output format, or
+// fallback for any other format.
+func PCMSampleRate(format string, fallback int) int {
+	rate, ok := strings.CutPrefix(format, "pcm_")
+	if !ok {
+		return fallback
+	}
+	if n, err := strconv.Atoi(rate); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
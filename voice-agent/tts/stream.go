@@ -0,0 +1,60 @@
+package tts
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+)
+
+// StreamingSynthesizer can start speaking before it has the whole text: text
+// is written in pieces as it is produced and audio comes back on the same
+// stream.
+type StreamingSynthesizer interface {
+	Synthesizer
+	OpenStream(ctx context.Context, opts Options, sampleRate int) (TextStream, error)
+}
+
+// TextStream is one synthesis fed incrementally. Reading yields mono 16-bit
+// little-endian PCM at the stream's sample rate and ends with io.EOF once
+// CloseText has been called and all audio has arrived.
+type TextStream interface {
+	io.Reader
+
+	// WriteText adds text. Words may be split across writes.
+	WriteText(text string) error
+	// Flush asks for audio for everything written so far, such as at the
+	// end of a sentence, instead of waiting for more text.
+	Flush() error
+	// CloseText marks the end of the text.
+	CloseText() error
+	// Alignment returns the timing of the characters whose audio has
+	// arrived so far.
+	Alignment() Alignment
+	// Close abandons the stream.
+	Close() error
+}
+
+// Alignment places each character of synthesized text on the audio
+// timeline, measured from the start of the stream.
+type Alignment struct {
+	Chars  []string
+	Starts []time.Duration
+}
+
+// SpokenBy returns the text whose audio started before played.
+func (a Alignment) SpokenBy(played time.Duration) string {
+	var text strings.Builder
+	for i, start := range a.Starts {
+		if start >= played {
+			break
+		}
+		text.WriteString(a.Chars[i])
+	}
+	return text.String()
+}
+
+// Text returns all aligned text.
+func (a Alignment) Text() string {
+	return strings.Join(a.Chars, "")
+}
@@ -0,0 +1,73 @@
+// Package tts turns agent replies into speech.
+package tts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"voice-agent/config"
+)
+
+// Synthesizer streams speech for text as raw mono 16-bit little-endian PCM
+// at sampleRate, in the voice opts selects. Cancelling ctx aborts the request
+// and the returned stream.
+type Synthesizer interface {
+	StreamPCM(ctx context.Context, text string, opts Options, sampleRate int) (io.ReadCloser, error)
+}
+
+// VoiceValidator is implemented by synthesizers that can check a voice ID
+// before a session uses it.
+type VoiceValidator interface {
+	ValidateVoice(ctx context.Context, voiceID string) error
+}
+
+var (
+	// ErrUnknownVoice means the voice does not exist for this account.
+	ErrUnknownVoice = errors.New("unknown voice")
+	// ErrVoiceListUnavailable means voices could not be checked at all.
+	ErrVoiceListUnavailable = errors.New("voice list unavailable")
+)
+
+// Factory creates a synthesizer from the service configuration.
+type Factory func(cfg *config.Config) (Synthesizer, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a synthesizer available under name. Vendors register
+// themselves from init, so adding one needs no changes elsewhere.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// New creates the synthesizer registered under name.
+func New(name string, cfg *config.Config) (Synthesizer, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown TTS provider %q (have %v)", name, Names())
+	}
+	return factory(cfg)
+}
+
+// Names lists the registered providers.
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,230 @@
+// Package vad finds utterance boundaries in a stream of PCM frames.
+//
+// Detection is energy based: a frame is voiced when its level clears both an
+// absolute threshold and a margin above the tracked background noise. A run
+// of voiced frames becomes speech once it lasts MinSpeech, and speech ends
+// after Hangover of trailing silence. The noise floor follows the background
+// between utterances and, more cautiously, during them, so steady noise
+// loud enough to start an utterance soon ends it and starts no more.
+package vad
+
+import (
+	"math"
+	"time"
+)
+
+type Config struct {
+	SampleRate int
+
+	// SpeechThreshold is the level in dBFS a frame must reach to start speech.
+	SpeechThreshold float64
+	// SilenceThreshold is the level in dBFS below which a frame counts as
+	// silence once speech has started. Keeping it under SpeechThreshold stops
+	// quiet syllables from ending the utterance.
+	SilenceThreshold float64
+	// NoiseMargin is how far in dB a frame must rise above the noise floor.
+	NoiseMargin float64
+
+	// MinSpeech is the shortest run of voiced audio reported as speech.
+	MinSpeech time.Duration
+	// Hangover is the trailing silence that ends an utterance.
+	Hangover time.Duration
+	// PreRoll is audio from before the onset kept at the start of the
+	// utterance so the first syllable is not clipped.
+	PreRoll time.Duration
+	// MaxUtterance forces an utterance to end after this long.
+	MaxUtterance time.Duration
+}
+
+func DefaultConfig(sampleRate int) Config {
+	return Config{
+		SampleRate:       sampleRate,
+		SpeechThreshold:  -40,
+		SilenceThreshold: -48,
+		NoiseMargin:      10,
+		MinSpeech:        200 * time.Millisecond,
+		Hangover:         700 * time.Millisecond,
+		PreRoll:          300 * time.Millisecond,
+		MaxUtterance:     30 * time.Second,
+	}
+}
+
+type EventType int
+
+const (
+	SpeechStart EventType = iota
+	SpeechEnd
+)
+
+func (t EventType) String() string {
+	switch t {
+	case SpeechStart:
+		return "speech_start"
+	case SpeechEnd:
+		return "speech_end"
+	}
+	return "unknown"
+}
+
+type Event struct {
+	Type EventType
+	// At is the offset into the stream where the event applies: the onset
+	// for SpeechStart, the last voiced frame for SpeechEnd.
+	At time.Duration
+	// Audio holds the whole utterance, pre-roll included, on SpeechEnd.
+	Audio []int16
+	// AudioStart is the offset into the stream of Audio's first sample.
+	AudioStart time.Duration
+}
+
+const (
+	// noiseFloorRate is the smoothing factor for the background noise
+	// estimate between utterances.
+	noiseFloorRate = 0.05
+
+	// During speech the floor is only raised, once per noiseWindow, toward
+	// the quietest frame of that window by speechNoiseRate. Speech dips
+	// between words so its quietest frames stay low; steady noise does not.
+	noiseWindow     = time.Second
+	speechNoiseRate = 0.5
+)
+
+type Detector struct {
+	cfg Config
+
+	offset     time.Duration
+	noiseFloor float64
+	speaking   bool
+
+	onset   time.Duration
+	voiced  time.Duration
+	silence time.Duration
+	audio   []int16
+	preRoll []int16
+
+	window   time.Duration
+	quietest float64
+}
+
+func New(cfg Config) *Detector {
+	return &Detector{
+		cfg:        cfg,
+		noiseFloor: cfg.SilenceThreshold - cfg.NoiseMargin,
+	}
+}
+
+// Process feeds one frame and returns the events it triggered, if any.
+func (d *Detector) Process(frame []int16) []Event {
+	if len(frame) == 0 {
+		return nil
+	}
+
+	duration := time.Duration(len(frame)) * time.Second / time.Duration(d.cfg.SampleRate)
+	level := Level(frame)
+	start := d.offset
+	d.offset += duration
+
+	if !d.speaking {
+		return d.idle(frame, level, start, duration)
+	}
+	return d.inSpeech(frame, level, duration)
+}
+
+// Reset drops any utterance in progress.
+func (d *Detector) Reset() {
+	d.speaking = false
+	d.voiced = 0
+	d.silence = 0
+	d.audio = nil
+}
+
+// Speaking reports whether an utterance is in progress.
+func (d *Detector) Speaking() bool {
+	return d.speaking
+}
+
+func (d *Detector) idle(frame []int16, level float64, start, duration time.Duration) []Event {
+	if level < d.cfg.SpeechThreshold || level < d.noiseFloor+d.cfg.NoiseMargin {
+		d.noiseFloor += (level - d.noiseFloor) * noiseFloorRate
+		d.voiced = 0
+		d.audio = nil
+		d.keepPreRoll(frame)
+		return nil
+	}
+
+	if d.voiced == 0 {
+		d.onset = start
+		d.audio = append(append([]int16(nil), d.preRoll...), frame...)
+	} else {
+		d.audio = append(d.audio, frame...)
+	}
+	d.voiced += duration
+
+	if d.voiced < d.cfg.MinSpeech {
+		return nil
+	}
+
+	d.speaking = true
+	d.silence = 0
+	d.window = 0
+	d.preRoll = nil
+	return []Event{{Type: SpeechStart, At: d.onset}}
+}
+
+func (d *Detector) inSpeech(frame []int16, level float64, duration time.Duration) []Event {
+	d.audio = append(d.audio, frame...)
+	d.trackNoise(level, duration)
+
+	if level < d.cfg.SilenceThreshold || level < d.noiseFloor+d.cfg.NoiseMargin/2 {
+		d.silence += duration
+	} else {
+		d.silence = 0
+	}
+
+	if d.silence < d.cfg.Hangover && d.offset-d.onset < d.cfg.MaxUtterance {
+		return nil
+	}
+
+	audioLength := time.Duration(len(d.audio)) * time.Second / time.Duration(d.cfg.SampleRate)
+	end := Event{Type: SpeechEnd, At: d.offset - d.silence, Audio: d.audio, AudioStart: d.offset - audioLength}
+	d.Reset()
+	return []Event{end}
+}
+
+func (d *Detector) trackNoise(level float64, duration time.Duration) {
+	if d.window == 0 || level < d.quietest {
+		d.quietest = level
+	}
+	d.window += duration
+	if d.window < noiseWindow {
+		return
+	}
+
+	if d.quietest > d.noiseFloor {
+		d.noiseFloor += (d.quietest - d.noiseFloor) * speechNoiseRate
+	}
+	d.window = 0
+}
+
+func (d *Detector) keepPreRoll(frame []int16) {
+	limit := int(int64(d.cfg.PreRoll) * int64(d.cfg.SampleRate) / int64(time.Second))
+	d.preRoll = append(d.preRoll, frame...)
+	if len(d.preRoll) > limit {
+		d.preRoll = append([]int16(nil), d.preRoll[len(d.preRoll)-limit:]...)
+	}
+}
+
+// Level returns the RMS level of pcm in dBFS.
+func Level(pcm []int16) float64 {
+	var sum float64
+	for _, v := range pcm {
+		f := float64(v) / 32768
+		sum += f * f
+	}
+
+	rms := math.Sqrt(sum / float64(max(len(pcm), 1)))
+	if rms == 0 {
+		return -120
+	}
+	return 20 * math.Log10(rms)
+}
@@ -0,0 +1,168 @@
+package vad_test
+
+import (
+	"math"
+	"testing"
+	"time"
+	"voice-agent/vad"
+)
+
+const (
+	sampleRate = 16000
+	frameMs    = 20
+)
+
+// segment is a stretch of synthetic audio: a 300 Hz tone at amplitude, or
+// silence when amplitude is 0.
+type segment struct {
+	amplitude float64
+	duration  time.Duration
+}
+
+func tone(ms int) segment    { return segment{8000, time.Duration(ms) * time.Millisecond} }
+func silence(ms int) segment { return segment{0, time.Duration(ms) * time.Millisecond} }
+
+// run feeds the segments through a detector in 20 ms frames and returns the
+// events.
+func run(cfg vad.Config, segments ...segment) []vad.Event {
+	d := vad.New(cfg)
+	frame := sampleRate * frameMs / 1000
+
+	var events []vad.Event
+	n := 0
+	for _, seg := range segments {
+		frames := int(seg.duration / (frameMs * time.Millisecond))
+		for f := 0; f < frames; f++ {
+			pcm := make([]int16, frame)
+			for i := range pcm {
+				pcm[i] = int16(seg.amplitude * math.Sin(2*math.Pi*300*float64(n)/sampleRate))
+				n++
+			}
+			events = append(events, d.Process(pcm)...)
+		}
+	}
+	return events
+}
+
+func ms(d time.Duration) int { return int(d / time.Millisecond) }
+
+func TestDetector(t *testing.T) {
+	cfg := vad.DefaultConfig(sampleRate)
+
+	type utterance struct{ start, end, audioStart, audioMs int }
+	for _, tc := range []struct {
+		name     string
+		cfg      func(*vad.Config)
+		segments []segment
+		want     []utterance
+	}{
+		{
+			// Audio runs from the pre-roll to the end of the hangover.
+			name:     "utterance",
+			segments: []segment{silence(500), tone(1000), silence(1000)},
+			want:     []utterance{{start: 500, end: 1500, audioStart: 200, audioMs: 2000}},
+		},
+		{
+			name:     "shorter than MinSpeech",
+			segments: []segment{silence(500), tone(100), silence(1000)},
+		},
+		{
+			name:     "pause shorter than Hangover",
+			segments: []segment{silence(500), tone(500), silence(400), tone(500), silence(1000)},
+			want:     []utterance{{start: 500, end: 1900, audioStart: 200, audioMs: 2400}},
+		},
+		{
+			// Only the silence left after the hangover is pre-roll for the
+			// second utterance.
+			name:     "pause longer than Hangover",
+			segments: []segment{silence(500), tone(500), silence(800), tone(500), silence(1000)},
+			want: []utterance{
+				{start: 500, end: 1000, audioStart: 200, audioMs: 1500},
+				{start: 1800, end: 2300, audioStart: 1700, audioMs: 1300},
+			},
+		},
+		{
+			name:     "no pre-roll",
+			cfg:      func(c *vad.Config) { c.PreRoll = 0 },
+			segments: []segment{silence(500), tone(1000), silence(1000)},
+			want:     []utterance{{start: 500, end: 1500, audioStart: 500, audioMs: 1700}},
+		},
+		{
+			// Speech past the limit starts the next utterance, which the
+			// limit cuts short again.
+			name:     "MaxUtterance",
+			cfg:      func(c *vad.Config) { c.MaxUtterance = 500 * time.Millisecond },
+			segments: []segment{silence(500), tone(700), silence(1000)},
+			want: []utterance{
+				{start: 500, end: 1000, audioStart: 200, audioMs: 800},
+				{start: 1000, end: 1200, audioStart: 1000, audioMs: 500},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := cfg
+			if tc.cfg != nil {
+				tc.cfg(&c)
+			}
+			events := run(c, tc.segments...)
+
+			var got []utterance
+			for i := 0; i+1 < len(events); i += 2 {
+				start, end := events[i], events[i+1]
+				if start.Type != vad.SpeechStart || end.Type != vad.SpeechEnd {
+					t.Fatalf("events %v", events)
+				}
+				got = append(got, utterance{ms(start.At), ms(end.At), ms(end.AudioStart), len(end.Audio) * 1000 / sampleRate})
+			}
+			if len(events)%2 != 0 || len(got) != len(tc.want) {
+				t.Fatalf("utterances %+v from %d events, want %+v", got, len(events), tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("utterance %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestDetectorSteadyNoise checks that noise loud enough to pass for speech
+// is soon taken as background instead of cut into MaxUtterance pieces.
+func TestDetectorSteadyNoise(t *testing.T) {
+	cfg := vad.DefaultConfig(sampleRate)
+	events := run(cfg, silence(500), tone(60000))
+
+	if len(events) != 2 || events[1].Type != vad.SpeechEnd {
+		t.Fatalf("%d events over a minute of noise, want one utterance", len(events))
+	}
+	if end := events[1].At; end >= 10*time.Second {
+		t.Errorf("noise taken as speech until %v", end)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	square := make([]int16, 320)
+	sine := make([]int16, 320)
+	for i := range square {
+		square[i] = 32767
+		if i%2 == 1 {
+			square[i] = -32767
+		}
+		sine[i] = int16(16384 * math.Sin(2*math.Pi*float64(i)/32))
+	}
+
+	for _, tc := range []struct {
+		name string
+		pcm  []int16
+		want float64
+	}{
+		{"silence", make([]int16, 320), -120},
+		{"empty", nil, -120},
+		{"full scale", square, 0},
+		{"half scale sine", sine, -9.03},
+	} {
+		if got := vad.Level(tc.pcm); math.Abs(got-tc.want) > 0.05 {
+			t.Errorf("%s: Level = %.2f, want %.2f", tc.name, got, tc.want)
+		}
+	}
+}